@@ -0,0 +1,356 @@
+package recycleme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// amazonMarketplace is an Amazon store, with the host and region of its Product Advertising API 5.0
+type amazonMarketplace struct {
+	Marketplace string // e.g. www.amazon.fr
+	Host        string // e.g. webservices.amazon.fr
+	Region      string // e.g. eu-west-1
+}
+
+// amazonMarketplaces by domain suffix, as set in RECYCLEME_AMAZON_MARKETPLACE
+var amazonMarketplaces = map[string]amazonMarketplace{
+	"fr":     {"www.amazon.fr", "webservices.amazon.fr", "eu-west-1"},
+	"de":     {"www.amazon.de", "webservices.amazon.de", "eu-west-1"},
+	"co.uk":  {"www.amazon.co.uk", "webservices.amazon.co.uk", "eu-west-1"},
+	"es":     {"www.amazon.es", "webservices.amazon.es", "eu-west-1"},
+	"it":     {"www.amazon.it", "webservices.amazon.it", "eu-west-1"},
+	"nl":     {"www.amazon.nl", "webservices.amazon.nl", "eu-west-1"},
+	"com":    {"www.amazon.com", "webservices.amazon.com", "us-east-1"},
+	"ca":     {"www.amazon.ca", "webservices.amazon.ca", "us-east-1"},
+	"co.jp":  {"www.amazon.co.jp", "webservices.amazon.co.jp", "us-west-2"},
+	"com.au": {"www.amazon.com.au", "webservices.amazon.com.au", "us-west-2"},
+}
+
+const (
+	paapiService      = "ProductAdvertisingAPI"
+	paapiTargetPrefix = "com.amazon.paapi5.v1.ProductAdvertisingAPIv1."
+)
+
+// paapiResources are the fields requested for each item
+var paapiResources = []string{"ItemInfo.Title", "ItemInfo.ExternalIds", "Images.Primary.Large"}
+
+type paapiSearchItemsRequest struct {
+	Keywords    string
+	SearchIndex string
+	Resources   []string
+	PartnerTag  string
+	PartnerType string
+	Marketplace string
+}
+
+type paapiGetItemsRequest struct {
+	ItemIds     []string
+	ItemIdType  string
+	Resources   []string
+	PartnerTag  string
+	PartnerType string
+	Marketplace string
+}
+
+// paapiMaxItemIds is the maximum number of ASINs of a GetItems request
+const paapiMaxItemIds = 10
+
+// paapiResponse holds the fields we need from SearchItems and GetItems responses
+type paapiResponse struct {
+	SearchResult struct {
+		TotalResultCount int
+		Items            []paapiItem
+	}
+	ItemsResult struct {
+		Items []paapiItem
+	}
+	Errors []amazonError
+}
+
+type paapiItem struct {
+	ASIN          string
+	DetailPageURL string
+	ItemInfo      struct {
+		Title struct {
+			DisplayValue string
+		}
+		ExternalIds struct {
+			EANs struct {
+				DisplayValues []string
+			}
+			UPCs struct {
+				DisplayValues []string
+			}
+		}
+	}
+	Images struct {
+		Primary struct {
+			Large struct {
+				URL string
+			}
+		}
+	}
+}
+
+// hasExternalIds returns true if the item has EANs or UPCs, search results may not
+func (item paapiItem) hasExternalIds() bool {
+	return len(item.ItemInfo.ExternalIds.EANs.DisplayValues) > 0 || len(item.ItemInfo.ExternalIds.UPCs.DisplayValues) > 0
+}
+
+// hasEAN returns true if ean is one of the external ids (EAN or UPC) of the item
+func (item paapiItem) hasEAN(ean string) bool {
+	ean = canonicalEAN(ean)
+	for _, ids := range [][]string{item.ItemInfo.ExternalIds.EANs.DisplayValues, item.ItemInfo.ExternalIds.UPCs.DisplayValues} {
+		for _, id := range ids {
+			if canonicalEAN(id) == ean {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type amazonError struct {
+	Code    string
+	Message string
+}
+
+func (e *amazonError) Error() string {
+	return fmt.Sprintf("error from amazon: Code: %s, Message: %s", e.Code, e.Message)
+}
+
+// amazonURL fetches products with the Product Advertising API 5.0
+type amazonURL struct {
+	baseURL                            string // scheme and host of the API, overridden in tests
+	WebsiteName                        string
+	Marketplace                        amazonMarketplace
+	AccessKey, SecretKey, AssociateTag string
+	now                                func() time.Time
+}
+
+// newAmazonURLFetcher reads its credentials and marketplace (fr by default) from the environment
+func newAmazonURLFetcher() (amazonURL, error) {
+	fetcher := amazonURL{now: time.Now}
+	var accessOk, secretOk, associateTagOk bool
+	fetcher.AccessKey, accessOk = os.LookupEnv("RECYCLEME_ACCESS_KEY")
+	fetcher.SecretKey, secretOk = os.LookupEnv("RECYCLEME_SECRET_KEY")
+	fetcher.AssociateTag, associateTagOk = os.LookupEnv("RECYCLEME_ASSOCIATE_TAG")
+	if !accessOk || !secretOk || !associateTagOk {
+		return fetcher, errors.New("Missing either RECYCLEME_ACCESS_KEY, RECYCLEME_SECRET_KEY or RECYCLEME_ASSOCIATE_TAG in environment. AmazonFetcher will not be used")
+	}
+	domain := os.Getenv("RECYCLEME_AMAZON_MARKETPLACE")
+	if domain == "" {
+		domain = "fr"
+	}
+	marketplace, ok := amazonMarketplaces[domain]
+	if !ok {
+		return fetcher, fmt.Errorf("Unknown amazon marketplace %v in RECYCLEME_AMAZON_MARKETPLACE. AmazonFetcher will not be used", domain)
+	}
+	fetcher.Marketplace = marketplace
+	fetcher.baseURL = "https://" + marketplace.Host
+	fetcher.WebsiteName = "Amazon." + domain
+	return fetcher, nil
+}
+
+func (f amazonURL) IsURLValidForEAN(url, ean string) bool {
+	return f.Marketplace.Host+"/"+ean == url
+}
+
+func (f amazonURL) Name() string {
+	return f.WebsiteName
+}
+
+// AcceptsCategory returns true for products, books and periodicals
+func (f amazonURL) AcceptsCategory(c BarcodeCategory) bool {
+	return c == CategoryProduct || c == CategoryBook || c == CategoryPeriodical
+}
+
+// do sends a signed request for operation (SearchItems, GetItems, ...) and decodes its response
+func (f amazonURL) do(ctx context.Context, operation string, request interface{}) (paapiResponse, error) {
+	var response paapiResponse
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", f.baseURL+"/paapi5/"+strings.ToLower(operation), bytes.NewReader(body))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Encoding", "amz-1.0")
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Amz-Target", paapiTargetPrefix+operation)
+	signV4(req, body, f.AccessKey, f.SecretKey, f.Marketplace.Region, paapiService, f.now())
+
+	resp, err := sendRequest(ctx, req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return response, err
+	}
+	if err := json.Unmarshal(b, &response); err != nil && resp.StatusCode == http.StatusOK {
+		return response, err
+	}
+	for _, e := range response.Errors {
+		switch e.Code {
+		case "NoResults", "ItemNotAccessible":
+			return response, errNotFound
+		case "TooManyRequests":
+			return response, errThrottled
+		}
+	}
+	if len(response.Errors) > 0 {
+		var errs []string
+		for _, e := range response.Errors {
+			errs = append(errs, e.Error())
+		}
+		return response, errors.New(strings.Join(errs, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return response, &httpStatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
+	return response, nil
+}
+
+// searchItems searches items by keywords in all categories
+func (f amazonURL) searchItems(ctx context.Context, keywords string) ([]paapiItem, int, error) {
+	response, err := f.do(ctx, "SearchItems", paapiSearchItemsRequest{
+		Keywords:    keywords,
+		SearchIndex: "All",
+		Resources:   paapiResources,
+		PartnerTag:  f.AssociateTag,
+		PartnerType: "Associates",
+		Marketplace: f.Marketplace.Marketplace,
+	})
+	return response.SearchResult.Items, response.SearchResult.TotalResultCount, err
+}
+
+// getItems gets items by ASIN, at most paapiMaxItemIds of them
+func (f amazonURL) getItems(ctx context.Context, asins ...string) ([]paapiItem, error) {
+	if len(asins) > paapiMaxItemIds {
+		asins = asins[:paapiMaxItemIds]
+	}
+	response, err := f.do(ctx, "GetItems", paapiGetItemsRequest{
+		ItemIds:     asins,
+		ItemIdType:  "ASIN",
+		Resources:   paapiResources,
+		PartnerTag:  f.AssociateTag,
+		PartnerType: "Associates",
+		Marketplace: f.Marketplace.Marketplace,
+	})
+	return response.ItemsResult.Items, err
+}
+
+// Fetch searches the EAN, and keeps the only item with this EAN.
+// The keyword search may match other products: items found without external ids are checked with GetItems.
+func (f amazonURL) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	endPoint := fmt.Sprintf("%s/%s", f.Marketplace.Host, ean)
+	return withCheckInBlacklist(db, ean, endPoint, func() (Product, error) {
+		items, total, err := f.searchItems(ctx, ean)
+		if err != nil {
+			return Product{}, err
+		}
+		if len(items) == 0 {
+			return Product{}, errNotFound
+		}
+		var matching []paapiItem
+		var unchecked []string
+		for _, item := range items {
+			if item.hasEAN(ean) {
+				matching = append(matching, item)
+			} else if !item.hasExternalIds() {
+				unchecked = append(unchecked, item.ASIN)
+			}
+		}
+		if len(matching) == 0 && len(unchecked) > 0 {
+			checked, err := f.getItems(ctx, unchecked...)
+			if err != nil {
+				return Product{}, err
+			}
+			for _, item := range checked {
+				if item.hasEAN(ean) {
+					matching = append(matching, item)
+				}
+			}
+		}
+		if len(matching) != 1 {
+			if len(matching) > 1 || total > 1 || len(items) > 1 {
+				return Product{}, errTooManyProducts
+			}
+			// the only item found is another product
+			return Product{}, errNotFound
+		}
+
+		item := matching[0]
+		return Product{EAN: ean, URL: endPoint, Name: item.ItemInfo.Title.DisplayValue, ImageURL: item.Images.Primary.Large.URL, WebsiteURL: item.DetailPageURL, WebsiteName: f.WebsiteName}, nil
+	})
+}
+
+// signV4 signs req with AWS Signature Version 4, all its headers (and Host) are signed
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,169 @@
+package recycleme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla and post-vanilla from the AWS Signature Version 4 test suite
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for method, signature := range map[string]string{
+		"GET":  "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"POST": "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+	} {
+		req, err := http.NewRequest(method, "https://example.amazonaws.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + signature
+		if auth := req.Header.Get("Authorization"); auth != expected {
+			t.Errorf("%v: expected %v, got %v", method, expected, auth)
+		}
+	}
+}
+
+// paapiStandIn answers SearchItems and GetItems requests like PA-API 5, checking their signature.
+// Searched items have no external ids, except for 5021991938818 and 4006381333634, they are given by GetItems.
+func paapiStandIn(f amazonURL) *httptest.Server {
+	item := func(asin, ean string) map[string]interface{} {
+		return map[string]interface{}{
+			"ASIN":          asin,
+			"DetailPageURL": "https://www.amazon.fr/dp/" + asin,
+			"ItemInfo": map[string]interface{}{
+				"Title":       map[string]interface{}{"DisplayValue": "Item " + asin},
+				"ExternalIds": map[string]interface{}{"EANs": map[string]interface{}{"DisplayValues": []string{ean}}},
+			},
+		}
+	}
+	// searched returns an item without external ids, as search results may be
+	searched := func(asin string) map[string]interface{} {
+		i := item(asin, "")
+		delete(i["ItemInfo"].(map[string]interface{}), "ExternalIds")
+		return i
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.Path, nil)
+		for _, h := range []string{"Content-Encoding", "Content-Type", "X-Amz-Target"} {
+			check.Header.Set(h, r.Header.Get(h))
+		}
+		signV4(check, body, f.AccessKey, f.SecretKey, f.Marketplace.Region, paapiService, f.now())
+		if r.Method != "POST" || r.Header.Get("Authorization") != check.Header.Get("Authorization") || r.Header.Get("Content-Encoding") != "amz-1.0" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"Errors":[{"Code":"InvalidSignature","Message":"The request has not been correctly signed."}]}`)
+			return
+		}
+
+		var req struct {
+			Keywords    string
+			ItemIds     []string
+			PartnerTag  string
+			Marketplace string
+		}
+		json.Unmarshal(body, &req)
+		if req.PartnerTag != f.AssociateTag || req.Marketplace != "www.amazon.fr" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"Errors":[{"Code":"InvalidPartnerTag","Message":"The partner tag is invalid."}]}`)
+			return
+		}
+		var response interface{}
+		switch {
+		case r.URL.Path == "/paapi5/getitems" && r.Header.Get("X-Amz-Target") == paapiTargetPrefix+"GetItems":
+			var items []interface{}
+			for _, asin := range req.ItemIds {
+				items = append(items, item(asin, getItemsEANs[asin]))
+			}
+			response = map[string]interface{}{"ItemsResult": map[string]interface{}{"Items": items}}
+		case r.URL.Path != "/paapi5/searchitems" || r.Header.Get("X-Amz-Target") != paapiTargetPrefix+"SearchItems":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case req.Keywords == "5021991938818":
+			b, _ := ioutil.ReadFile("testdata/json/amazon_searchitems.json")
+			w.Write(b)
+			return
+		case req.Keywords == "4006381333634":
+			response = map[string]interface{}{"SearchResult": map[string]interface{}{"TotalResultCount": 2, "Items": []interface{}{item("B0001", "4006381333627"), item("B0002", "4006381333634")}}}
+		case req.Keywords == "3057640136573":
+			response = map[string]interface{}{"SearchResult": map[string]interface{}{"TotalResultCount": 2, "Items": []interface{}{searched("B0003"), searched("B0004")}}}
+		case req.Keywords == "3600523183227":
+			response = map[string]interface{}{"SearchResult": map[string]interface{}{"TotalResultCount": 2, "Items": []interface{}{searched("B0005"), searched("B0006")}}}
+		case req.Keywords == "7613034383808":
+			response = map[string]interface{}{"SearchResult": map[string]interface{}{"TotalResultCount": 1, "Items": []interface{}{searched("B0007")}}}
+		case req.Keywords == "3270160891382":
+			w.WriteHeader(http.StatusTooManyRequests)
+			response = map[string]interface{}{"Errors": []interface{}{map[string]string{"Code": "TooManyRequests", "Message": "The request was denied due to request throttling."}}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			response = map[string]interface{}{"Errors": []interface{}{map[string]string{"Code": "NoResults", "Message": "No results found for your request."}}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// getItemsEANs are the EANs of the items returned by the GetItems stand-in
+var getItemsEANs = map[string]string{"B0003": "3057640136566", "B0004": "3057640136559", "B0005": "3600523183210", "B0006": "3600523183227", "B0007": "7613034383815"}
+
+func TestAmazonPAAPI5(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := amazonURL{WebsiteName: "Amazon.fr", Marketplace: amazonMarketplaces["fr"], AccessKey: "AKID", SecretKey: "secret", AssociateTag: "howtorecme-21", now: func() time.Time { return now }}
+	ts := paapiStandIn(f)
+	defer ts.Close()
+	f.baseURL = ts.URL
+	host := strings.TrimPrefix(ts.URL, "http://")
+	SetHostRateLimit(host, RateLimit{PerSecond: 1000, Burst: 100})
+	defer SetHostRateLimit(host, DefaultRateLimit)
+
+	p, err := f.Fetch(context.Background(), "5021991938818", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Clipper Thé Vert Biologique 20 infusettes" ||
+		p.EAN != "5021991938818" ||
+		p.URL != "webservices.amazon.fr/5021991938818" ||
+		p.ImageURL != "https://m.media-amazon.com/images/I/517qE9owUDL.jpg" ||
+		p.WebsiteURL != "https://www.amazon.fr/dp/B011C4L3S0?tag=howtorecme-21&linkCode=osi&th=1&psc=1" ||
+		p.WebsiteName != "Amazon.fr" {
+		t.Errorf("Some attributes are invalid for: %v", p)
+	}
+	if !f.IsURLValidForEAN(p.URL, p.EAN) {
+		t.Errorf("%v should be valid for %v", p.URL, p.EAN)
+	}
+
+	// an ambiguous search keeps the item with the EAN
+	if p, err := f.Fetch(context.Background(), "4006381333634", blacklistDB); err != nil || p.Name != "Item B0002" {
+		t.Errorf("expected Item B0002, got %v, %v", p, err)
+	}
+	// items searched without external ids are checked with GetItems
+	if p, err := f.Fetch(context.Background(), "3600523183227", blacklistDB); err != nil || p.Name != "Item B0006" {
+		t.Errorf("expected Item B0006, got %v, %v", p, err)
+	}
+	items, err := f.getItems(context.Background(), "B0006")
+	if err != nil || len(items) != 1 || items[0].ASIN != "B0006" || !items[0].hasEAN("3600523183227") {
+		t.Errorf("unexpected items: %+v, %v", items, err)
+	}
+	for ean, check := range map[string]func(error) bool{
+		"3057640136573": func(err error) bool { return err.(*productError).err == errTooManyProducts },
+		"4012345123456": isNotFound,
+		"7613034383808": isNotFound, // the only item found has another EAN
+		"3270160891382": func(err error) bool { return err.(*productError).err == errThrottled },
+	} {
+		if _, err := f.Fetch(context.Background(), ean, blacklistDB); err == nil || !check(err) {
+			t.Errorf("unexpected error for %v: %v", ean, err)
+		}
+	}
+
+	f.SecretKey = "wrong"
+	_, err = f.Fetch(context.Background(), "5021991938818", blacklistDB)
+	if err == nil || !strings.Contains(err.Error(), "InvalidSignature") {
+		t.Errorf("expected invalid signature error, got %v", err)
+	}
+}
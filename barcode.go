@@ -0,0 +1,264 @@
+package recycleme
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BarcodeFormat is a representation of a GTIN (Global Trade Item Number), the number behind EAN, UPC and ISBN barcodes
+type BarcodeFormat int
+
+const (
+	BarcodeGTIN   BarcodeFormat = iota // canonical GTIN, as returned by NormalizeBarcode
+	BarcodeEAN13                       // 13 digits, EAN-8 are padded with zeros
+	BarcodeEAN8                        // 8 digits
+	BarcodeUPCA                        // 12 digits, EAN-13 starting with 0
+	BarcodeUPCE                        // 8 digits, zero-suppressed UPC-A
+	BarcodeGTIN14                      // 14 digits, padded with zeros
+	BarcodeISBN10                      // 10 characters, EAN-13 starting with 978
+	BarcodeISBN                        // ISBN-10 of EAN-13 starting with 978, EAN-13 starting with 979 which have no ISBN-10
+)
+
+var barcodeFormatNames = map[BarcodeFormat]string{
+	BarcodeGTIN:   "gtin",
+	BarcodeEAN13:  "ean13",
+	BarcodeEAN8:   "ean8",
+	BarcodeUPCA:   "upca",
+	BarcodeUPCE:   "upce",
+	BarcodeGTIN14: "gtin14",
+	BarcodeISBN10: "isbn10",
+	BarcodeISBN:   "isbn",
+}
+
+func (f BarcodeFormat) String() string {
+	if name, ok := barcodeFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("BarcodeFormat(%d)", int(f))
+}
+
+// parseBarcodeFormat parses the name of a BarcodeFormat (gtin, ean13, ...), gtin if empty
+func parseBarcodeFormat(name string) (BarcodeFormat, error) {
+	if name == "" {
+		return BarcodeGTIN, nil
+	}
+	for f, n := range barcodeFormatNames {
+		if n == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return BarcodeGTIN, fmt.Errorf("unknown barcode format %q", name)
+}
+
+var errUnsupportedBarcode = errors.New("barcode cannot be represented in the format of this source")
+
+// NormalizeBarcode validates an EAN-13, EAN-8, UPC-A, UPC-E, GTIN-14 or ISBN-10 code and returns its canonical GTIN:
+// the EAN-8 for EAN-8 codes (even zero-padded to 12, 13 or 14 digits), the GTIN-14 for cases of products (indicator digit from 1 to 9), the EAN-13 otherwise.
+// Spaces and dashes are ignored. As 8 digits codes may be both valid EAN-8 and UPC-E, EAN-8 wins.
+func NormalizeBarcode(code string) (string, error) {
+	code = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+
+	switch len(code) {
+	case 8:
+		if validGTIN(code) {
+			return code, nil
+		}
+		if upca, ok := expandUPCE(code); ok && validGTIN(upca) {
+			return "0" + upca, nil
+		}
+	case 10:
+		if validISBN10(code) {
+			isbn13 := "978" + code[:9]
+			return isbn13 + string(gtinCheckDigit(isbn13)), nil
+		}
+	case 12:
+		if validGTIN(code) {
+			return shortenEAN13("0" + code), nil
+		}
+	case 13:
+		if validGTIN(code) {
+			return shortenEAN13(code), nil
+		}
+	case 14:
+		if validGTIN(code) {
+			if code[0] == '0' {
+				return shortenEAN13(code[1:]), nil
+			}
+			return code, nil
+		}
+	}
+	return "", errInvalidEAN
+}
+
+// shortenEAN13 returns the EAN-8 of a zero-padded EAN-8 (prefix 00000, which has the same check digit), ean13 otherwise
+func shortenEAN13(ean13 string) string {
+	if strings.HasPrefix(ean13, "00000") {
+		return ean13[5:]
+	}
+	return ean13
+}
+
+// FormatBarcode normalizes code and returns it in format, or errUnsupportedBarcode if this GTIN has no such representation
+// (e.g. an ISBN-10 for a product which is not a book)
+func FormatBarcode(code string, format BarcodeFormat) (string, error) {
+	gtin, err := NormalizeBarcode(code)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case BarcodeGTIN:
+		return gtin, nil
+	case BarcodeEAN13:
+		if len(gtin) <= 13 {
+			return strings.Repeat("0", 13-len(gtin)) + gtin, nil
+		}
+	case BarcodeEAN8:
+		if len(gtin) == 8 {
+			return gtin, nil
+		}
+	case BarcodeUPCA:
+		if len(gtin) == 13 && gtin[0] == '0' {
+			return gtin[1:], nil
+		}
+	case BarcodeUPCE:
+		if len(gtin) == 13 && gtin[0] == '0' {
+			if upce, ok := compressUPCA(gtin[1:]); ok {
+				return upce, nil
+			}
+		}
+	case BarcodeGTIN14:
+		return strings.Repeat("0", 14-len(gtin)) + gtin, nil
+	case BarcodeISBN10:
+		if len(gtin) == 13 && strings.HasPrefix(gtin, "978") {
+			return gtin[3:12] + string(isbn10CheckDigit(gtin[3:12])), nil
+		}
+	case BarcodeISBN:
+		if len(gtin) == 13 && strings.HasPrefix(gtin, "978") {
+			return FormatBarcode(gtin, BarcodeISBN10)
+		}
+		if len(gtin) == 13 && strings.HasPrefix(gtin, "979") {
+			return gtin, nil
+		}
+	default:
+		return "", fmt.Errorf("unknown barcode format %v", format)
+	}
+	return "", errUnsupportedBarcode
+}
+
+// canonicalEAN returns the canonical GTIN of ean, or ean itself if it is invalid
+func canonicalEAN(ean string) string {
+	if gtin, err := NormalizeBarcode(ean); err == nil {
+		return gtin
+	}
+	return ean
+}
+
+// legacyEANs returns the other keys a package of ean may have been stored under before barcodes were normalized:
+// the code as given, its zero-padded EAN-13 and its UPC-A
+func legacyEANs(ean string) []string {
+	canonical := canonicalEAN(ean)
+	var keys []string
+	seen := map[string]bool{canonical: true}
+	candidates := []string{ean}
+	for _, format := range []BarcodeFormat{BarcodeEAN13, BarcodeUPCA} {
+		if code, err := FormatBarcode(ean, format); err == nil {
+			candidates = append(candidates, code)
+		}
+	}
+	for _, key := range candidates {
+		if !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	return keys
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// gtinCheckDigit computes the check digit of a GTIN without its check digit, whatever its length:
+// digits are weighted 3 and 1 alternately from the right
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i -= 2 {
+		sum += 3 * int(digits[i]-'0')
+		if i > 0 {
+			sum += int(digits[i-1] - '0')
+		}
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func validGTIN(code string) bool {
+	return len(code) > 1 && isDigits(code) && gtinCheckDigit(code[:len(code)-1]) == code[len(code)-1]
+}
+
+// isbn10CheckDigit computes the check digit of the first 9 digits of an ISBN-10, X standing for 10
+func isbn10CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func validISBN10(code string) bool {
+	if len(code) != 10 || !isDigits(code[:9]) {
+		return false
+	}
+	return isbn10CheckDigit(code[:9]) == byte(strings.ToUpper(code[9:])[0])
+}
+
+// expandUPCE returns the UPC-A of a UPC-E (number system 0 or 1, 6 digits, check digit), without checking its check digit
+func expandUPCE(upce string) (string, bool) {
+	if len(upce) != 8 || !isDigits(upce) || (upce[0] != '0' && upce[0] != '1') {
+		return "", false
+	}
+	n, d, check := upce[:1], upce[1:7], upce[7:]
+	switch d[5] {
+	case '0', '1', '2':
+		return n + d[:2] + d[5:] + "0000" + d[2:5] + check, true
+	case '3':
+		return n + d[:3] + "00000" + d[3:5] + check, true
+	case '4':
+		return n + d[:4] + "00000" + d[4:5] + check, true
+	default:
+		return n + d[:5] + "0000" + d[5:] + check, true
+	}
+}
+
+// compressUPCA returns the UPC-E of a UPC-A, if it has enough zeros to be suppressed
+func compressUPCA(upca string) (string, bool) {
+	if len(upca) != 12 || (upca[0] != '0' && upca[0] != '1') {
+		return "", false
+	}
+	n, m, p, check := upca[:1], upca[1:6], upca[6:11], upca[11:]
+	switch {
+	case (m[2:] == "000" || m[2:] == "100" || m[2:] == "200") && p[:2] == "00":
+		return n + m[:2] + p[2:] + m[2:3] + check, true
+	case m[3:] == "00" && p[:3] == "000":
+		return n + m[:3] + p[3:] + "3" + check, true
+	case m[4] == '0' && p[:4] == "0000":
+		return n + m[:4] + p[4:] + "4" + check, true
+	case p[:4] == "0000" && p[4] >= '5':
+		return n + m + p[4:] + check, true
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package recycleme
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeBarcode(t *testing.T) {
+	for code, expected := range map[string]string{
+		"5029053038896":   "5029053038896", // EAN-13
+		"96385074":        "96385074",      // EAN-8
+		"012345678905":    "0012345678905", // UPC-A
+		"04252614":        "0042100005264", // UPC-E
+		"00012345678905":  "0012345678905", // GTIN-14 of a UPC-A
+		"00000096385074":  "96385074",      // GTIN-14 of an EAN-8
+		"0000096385074":   "96385074",      // EAN-13 of an EAN-8
+		"000096385074":    "96385074",      // UPC-A of an EAN-8
+		"10012345678902":  "10012345678902",
+		"0-306-40615-2":   "9780306406157", // ISBN-10
+		"080442957X":      "9780804429573",
+		"5 029053 038896": "5029053038896",
+	} {
+		if gtin, err := NormalizeBarcode(code); err != nil {
+			t.Errorf("%v: %v", code, err)
+		} else if gtin != expected {
+			t.Errorf("%v: expected %v, got %v", code, expected, gtin)
+		}
+	}
+
+	for _, code := range []string{"", "invalid", "5029053038897", "96385075", "012345678906", "0306406153", "12345", "10012345678903"} {
+		if gtin, err := NormalizeBarcode(code); err != errInvalidEAN {
+			t.Errorf("%v should be invalid, got %v, %v", code, gtin, err)
+		}
+	}
+}
+
+func TestFormatBarcode(t *testing.T) {
+	for _, test := range []struct {
+		code     string
+		format   BarcodeFormat
+		expected string
+		err      error
+	}{
+		{"0012345678905", BarcodeGTIN, "0012345678905", nil},
+		{"012345678905", BarcodeEAN13, "0012345678905", nil},
+		{"96385074", BarcodeEAN13, "0000096385074", nil},
+		{"96385074", BarcodeEAN8, "96385074", nil},
+		{"0012345678905", BarcodeUPCA, "012345678905", nil},
+		{"0042100005264", BarcodeUPCE, "04252614", nil},
+		{"0012345678905", BarcodeGTIN14, "00012345678905", nil},
+		{"9780306406157", BarcodeISBN10, "0306406152", nil},
+		{"9780804429573", BarcodeISBN10, "080442957X", nil},
+		{"9780306406157", BarcodeISBN, "0306406152", nil},
+		{"9791032305690", BarcodeISBN, "9791032305690", nil},
+		{"5029053038896", BarcodeISBN, "", errUnsupportedBarcode},
+		{"5029053038896", BarcodeUPCA, "", errUnsupportedBarcode},
+		{"0012345678905", BarcodeUPCE, "", errUnsupportedBarcode},
+		{"5029053038896", BarcodeISBN10, "", errUnsupportedBarcode},
+		{"0012345678905", BarcodeEAN8, "", errUnsupportedBarcode},
+		{"10012345678902", BarcodeEAN13, "", errUnsupportedBarcode},
+		{"invalid", BarcodeGTIN, "", errInvalidEAN},
+	} {
+		code, err := FormatBarcode(test.code, test.format)
+		if code != test.expected || err != test.err {
+			t.Errorf("%v as %v: expected %v, %v, got %v, %v", test.code, test.format, test.expected, test.err, code, err)
+		}
+	}
+
+	// UPC-E round trips
+	for _, upce := range []string{"04252614", "01234565", "01234531", "01234542", "11234506"} {
+		upca, ok := expandUPCE(upce)
+		if !ok {
+			t.Fatalf("%v should expand", upce)
+		}
+		if compressed, ok := compressUPCA(upca); !ok || compressed != upce {
+			t.Errorf("%v expanded to %v, compressed back to %v", upce, upca, compressed)
+		}
+	}
+}
+
+func TestLegacyEANs(t *testing.T) {
+	for code, expected := range map[string][]string{
+		"0036000291452": {"036000291452"},
+		"036000291452":  {"036000291452"},
+		"40170725":      {"0000040170725"},
+		"0000040170725": {"0000040170725"},
+		"5029053038896": nil,
+		"invalid":       nil,
+	} {
+		if keys := legacyEANs(code); !reflect.DeepEqual(keys, expected) {
+			t.Errorf("%v: expected %v, got %v", code, expected, keys)
+		}
+	}
+}
+
+func TestFetchableURLBarcode(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, "<html><body><p class=\"detailtitle\">Title <b>product</b></p></body></html>")
+	}))
+	defer ts.Close()
+
+	def := upcItemDbScraper
+	def.URL = ts.URL + "/upc/%s"
+	def.Barcode = "upca"
+	f, err := NewScraperFetcher(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := f.Fetch(context.Background(), "0012345678905", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/upc/012345678905" {
+		t.Errorf("the UPC-A should be requested, got %v", paths)
+	}
+	if p.EAN != "0012345678905" || p.URL != ts.URL+"/upc/012345678905" {
+		t.Errorf("unexpected product %v", p)
+	}
+	if !f.IsURLValidForEAN(ts.URL+"/upc/012345678905", "0012345678905") {
+		t.Error("url should be valid for the EAN")
+	}
+
+	if _, err := f.Fetch(context.Background(), "5029053038896", blacklistDB); !isNotFound(err) {
+		t.Errorf("an EAN without UPC-A should not be found, got %v", err)
+	}
+	if len(paths) != 1 {
+		t.Errorf("no request should be sent for a barcode without UPC-A, got %v", paths)
+	}
+}
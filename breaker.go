@@ -0,0 +1,216 @@
+package recycleme
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("source unavailable, circuit open")
+
+// CircuitState of a source: closed when healthy, open when failing, half-open when probing a failing source
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+func (s CircuitState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive failures to open the circuit of a source
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is how long a circuit stays open before probing the source again
+	DefaultBreakerCooldown = time.Minute
+)
+
+// SourceHealth reports the state of a source and its outcomes since startup
+type SourceHealth struct {
+	Name                string       `json:"name"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Successes           uint         `json:"successes"`
+	Failures            uint         `json:"failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// isSourceFailure returns true if err means the source is unavailable (network error, 5xx or still throttling us),
+// not that the product is missing
+func isSourceFailure(err error) bool {
+	if pErr, ok := err.(*productError); ok {
+		err = pErr.err
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, errThrottled) {
+		return true
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isUnreached returns true if err means no request was sent to the source (blacklisted url, rate limited,
+// disallowed by robots.txt or unsupported barcode), so it tells nothing about its health
+func isUnreached(err error) bool {
+	return errors.Is(err, errBlacklisted) || errors.Is(err, errRateLimited) || errors.Is(err, errDisallowedByRobots) || errors.Is(err, errUnsupportedBarcode)
+}
+
+// circuitBreaker opens after threshold consecutive failures, and lets one probe through (half-open) after cooldown.
+// A successful probe closes it, a failed one opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+	successes, failures uint
+	lastError           string
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns true if a request can be sent to the source
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// release ends a probe without outcome, when the source was not reached or the fetch was cancelled
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record the outcome of a request, outcomes of requests which did not reach the source (see isUnreached) are neutral
+func (b *circuitBreaker) record(err error) {
+	if err != nil && isUnreached(err) {
+		b.release()
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil || !isSourceFailure(err) {
+		b.successes++
+		b.consecutiveFailures = 0
+		b.state = CircuitClosed
+		return
+	}
+	b.failures++
+	b.consecutiveFailures++
+	b.lastError = err.Error()
+	if b.state == CircuitHalfOpen || b.consecutiveFailures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *circuitBreaker) health(name string) SourceHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := SourceHealth{
+		Name:                name,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		Successes:           b.successes,
+		Failures:            b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		h.OpenedAt = &openedAt
+	}
+	return h
+}
+
+// breakerFetcher skips its Fetcher while its circuit is open
+type breakerFetcher struct {
+	Fetcher
+	breaker *circuitBreaker
+}
+
+func newBreakerFetcher(f Fetcher) breakerFetcher {
+	return breakerFetcher{Fetcher: f, breaker: newCircuitBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown)}
+}
+
+func (f breakerFetcher) Name() string {
+	return fetcherName(f.Fetcher)
+}
+
+func (f breakerFetcher) AcceptsCategory(c BarcodeCategory) bool {
+	return acceptsCategory(f.Fetcher, c)
+}
+
+func (f breakerFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	if !f.breaker.allow() {
+		return Product{}, newProductError(ean, f.Name(), errCircuitOpen)
+	}
+	p, err := f.Fetcher.Fetch(ctx, ean, db)
+	if ctx.Err() != nil {
+		// cancelled because another fetcher won, it tells nothing about the source
+		f.breaker.release()
+		return p, err
+	}
+	f.breaker.record(err)
+	return p, err
+}
+
+// Health returns the state of each source of the DefaultFetcher
+func (f DefaultFetcher) Health() []SourceHealth {
+	var health []SourceHealth
+	for _, fetcher := range f.fetchers {
+		if bf, ok := fetcher.(breakerFetcher); ok {
+			health = append(health, bf.breaker.health(bf.Name()))
+		} else {
+			health = append(health, SourceHealth{Name: fetcherName(fetcher), State: CircuitClosed})
+		}
+	}
+	return health
+}
@@ -0,0 +1,147 @@
+package recycleme
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsSourceFailure(t *testing.T) {
+	failures := []error{
+		newProductError("ean", "http://www.example.com", &httpStatusError{URL: "http://www.example.com", StatusCode: 503}),
+		newProductError("ean", "http://www.example.com", &url.Error{Op: "Get", URL: "http://www.example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}),
+		context.DeadlineExceeded,
+	}
+	for _, err := range failures {
+		if !isSourceFailure(err) {
+			t.Errorf("%v should be a source failure", err)
+		}
+	}
+	others := []error{
+		newProductError("ean", "http://www.example.com", errNotFound),
+		newProductError("ean", "http://www.example.com", errTooManyProducts),
+		newProductError("ean", "http://www.example.com", &httpStatusError{URL: "http://www.example.com", StatusCode: 403}),
+		newProductError("ean", "http://www.example.com", &url.Error{Op: "Get", URL: "http://www.example.com", Err: context.Canceled}),
+	}
+	for _, err := range others {
+		if isSourceFailure(err) {
+			t.Errorf("%v should not be a source failure", err)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(3, time.Minute)
+	b.now = func() time.Time { return now }
+	failure := &httpStatusError{URL: "http://www.example.com", StatusCode: 500}
+
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatal("circuit should be closed")
+		}
+		b.record(failure)
+	}
+	// not found means the source is up
+	b.record(errNotFound)
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatal("circuit should be closed")
+		}
+		if i == 1 {
+			// a website still throttling us is failing too, unlike our own rate limiter
+			b.record(newProductError("ean", "http://www.example.com", errThrottled))
+			continue
+		}
+		b.record(failure)
+	}
+	if b.allow() {
+		t.Fatal("circuit should be open after 3 consecutive failures")
+	}
+	h := b.health("test")
+	if h.State != CircuitOpen || h.ConsecutiveFailures != 3 || h.Failures != 5 || h.Successes != 1 || h.LastError != failure.Error() || h.OpenedAt == nil {
+		t.Errorf("invalid health: %+v", h)
+	}
+
+	// half-open after cooldown, only one probe at a time
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("circuit should be half-open after cooldown")
+	}
+	if b.allow() {
+		t.Fatal("only one probe allowed")
+	}
+	if b.health("test").State != CircuitHalfOpen {
+		t.Errorf("circuit should be half-open")
+	}
+	b.record(failure)
+	if b.allow() {
+		t.Fatal("circuit should be open again after a failed probe")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("circuit should be half-open after cooldown")
+	}
+	// a probe which did not reach the source neither closes nor opens the circuit
+	before := b.health("test")
+	for _, err := range []error{
+		newProductError("ean", "http://www.example.com", errBlacklisted),
+		errRateLimited,
+		newProductError("ean", "http://www.example.com", errDisallowedByRobots),
+		newProductError("ean", "http://www.example.com", errUnsupportedBarcode),
+	} {
+		b.record(err)
+		if h := b.health("test"); h.State != CircuitHalfOpen || h.Successes != before.Successes || h.ConsecutiveFailures != before.ConsecutiveFailures {
+			t.Fatalf("%v should be neutral, got %+v", err, h)
+		}
+		if !b.allow() {
+			t.Fatal("another probe should be allowed")
+		}
+	}
+	b.record(nil)
+	if !b.allow() || !b.allow() {
+		t.Fatal("circuit should be closed after a successful probe")
+	}
+	if h := b.health("test"); h.State != CircuitClosed || h.ConsecutiveFailures != 0 || h.OpenedAt != nil {
+		t.Errorf("invalid health: %+v", h)
+	}
+}
+
+func TestBreakerFetcher(t *testing.T) {
+	calls := int32(0)
+	failing := countingFetcher{calls: &calls, err: newProductError("5029053038896", "http://www.example.com", &httpStatusError{URL: "http://www.example.com", StatusCode: 502})}
+	bf := newBreakerFetcher(failing)
+	fetcher := DefaultFetcher{fetchers: []Fetcher{bf}}
+	for i := 0; i < DefaultBreakerThreshold+2; i++ {
+		fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	}
+	if calls != DefaultBreakerThreshold {
+		t.Errorf("expected %v calls before opening the circuit, got %v", DefaultBreakerThreshold, calls)
+	}
+	_, err := bf.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err == nil || err.(*productError).err != errCircuitOpen {
+		t.Errorf("expected circuit open error, got %v", err)
+	}
+
+	health := fetcher.Health()
+	if len(health) != 1 || health[0].State != CircuitOpen || health[0].Name != "recycleme.countingFetcher" {
+		t.Errorf("invalid health: %+v", health)
+	}
+
+	// cancelled fetches are not failures
+	cancelledCalls := int32(0)
+	bf = newBreakerFetcher(countingFetcher{calls: &cancelledCalls, err: context.Canceled})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < DefaultBreakerThreshold+1; i++ {
+		bf.Fetch(ctx, "5029053038896", blacklistDB)
+	}
+	if atomic.LoadInt32(&cancelledCalls) != DefaultBreakerThreshold+1 || bf.breaker.health("").State != CircuitClosed {
+		t.Errorf("cancelled fetches should not open the circuit")
+	}
+}
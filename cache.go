@@ -0,0 +1,147 @@
+package recycleme
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CachedProduct is the outcome of a lookup: a Product found, or not found
+type CachedProduct struct {
+	EAN       string    `bson:"ean"`
+	Found     bool      `bson:"found"`
+	Product   Product   `bson:"product"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// ProductCacheDB stores the outcome of lookups by EAN
+type ProductCacheDB interface {
+	// Get returns the cached lookup for ean, false if there is none (expired entries may be returned)
+	Get(ean string) (CachedProduct, bool, error)
+	Set(c CachedProduct) error
+	Delete(ean string) error
+	// Purge deletes all cached lookups
+	Purge() error
+}
+
+const (
+	DefaultCacheTTL         = 24 * time.Hour
+	DefaultNotFoundCacheTTL = time.Hour
+)
+
+// CachedFetcher caches Products found by a Fetcher for TTL, and "not found" outcomes for NotFoundTTL.
+// Lookups are cached by normalized barcode, so a UPC-A and its EAN-13 share their entry.
+// Cached Products are evicted if one of their URLs (see Product.Sources) has been blacklisted since.
+type CachedFetcher struct {
+	Fetcher
+	DB          ProductCacheDB
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+	// Logger logs cache errors, the standard logger is used if nil
+	Logger *log.Logger
+}
+
+func NewCachedFetcher(f Fetcher, db ProductCacheDB) CachedFetcher {
+	return CachedFetcher{Fetcher: f, DB: db, TTL: DefaultCacheTTL, NotFoundTTL: DefaultNotFoundCacheTTL}
+}
+
+// Fetch returns the cached lookup for ean if it has not expired, otherwise the Product is fetched and cached.
+// Cache errors are not fatal, they are logged and the Product is then fetched as if not cached.
+func (f CachedFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	key := canonicalEAN(ean)
+	c, ok, err := f.DB.Get(key)
+	if err != nil {
+		f.logError(err)
+	} else if ok && time.Now().Before(c.ExpiresAt) {
+		if !c.Found {
+			return Product{}, newProductError(ean, "/cache/", errNotFound)
+		}
+		if blacklisted, err := anyBlacklisted(db, c.Product.urls()); err == nil && !blacklisted {
+			return c.Product, nil
+		}
+		if err := f.DB.Delete(key); err != nil {
+			f.logError(err)
+		}
+	}
+
+	p, err := f.Fetcher.Fetch(ctx, ean, db)
+	if err == nil {
+		if err := f.DB.Set(CachedProduct{EAN: key, Found: true, Product: p, ExpiresAt: time.Now().Add(f.TTL)}); err != nil {
+			f.logError(err)
+		}
+	} else if isNotFound(err) {
+		if err := f.DB.Set(CachedProduct{EAN: key, Found: false, ExpiresAt: time.Now().Add(f.NotFoundTTL)}); err != nil {
+			f.logError(err)
+		}
+	}
+	return p, err
+}
+
+func (f CachedFetcher) logError(err error) {
+	if f.Logger != nil {
+		f.Logger.Println("Product cache:", err)
+	} else {
+		log.Println("Product cache:", err)
+	}
+}
+
+// anyBlacklisted returns whether one of urls is in db
+func anyBlacklisted(db BlacklistDB, urls []string) (bool, error) {
+	for _, url := range urls {
+		if blacklisted, err := db.Contains(url); err != nil || blacklisted {
+			return blacklisted, err
+		}
+	}
+	return false, nil
+}
+
+type mgoProductCacheDB struct {
+	mgoDB
+	colName string
+}
+
+func NewMgoProductCacheDB(s *mgo.Session, colPrefix string) *mgoProductCacheDB {
+	return &mgoProductCacheDB{mgoDB: mgoDB{session: s}, colName: colPrefix + "product_cache"}
+}
+
+func (db mgoProductCacheDB) Get(ean string) (CachedProduct, bool, error) {
+	var c CachedProduct
+	found := false
+	err := withMgoSession(db.session, func(s *mgo.Session) error {
+		if err := s.DB("").C(db.colName).Find(bson.M{"ean": ean}).One(&c); err != nil {
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		found = true
+		return nil
+	})
+	return c, found, err
+}
+
+func (db mgoProductCacheDB) Set(c CachedProduct) error {
+	return withMgoSession(db.session, func(s *mgo.Session) error {
+		_, err := s.DB("").C(db.colName).Upsert(bson.M{"ean": c.EAN}, c)
+		return err
+	})
+}
+
+func (db mgoProductCacheDB) Delete(ean string) error {
+	return withMgoSession(db.session, func(s *mgo.Session) error {
+		if err := s.DB("").C(db.colName).Remove(bson.M{"ean": ean}); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+func (db mgoProductCacheDB) Purge() error {
+	return withMgoSession(db.session, func(s *mgo.Session) error {
+		_, err := s.DB("").C(db.colName).RemoveAll(nil)
+		return err
+	})
+}
@@ -0,0 +1,145 @@
+package recycleme
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetcher counts calls to Fetch, and returns its Product or error
+type countingFetcher struct {
+	calls *int32
+	p     Product
+	err   error
+}
+
+func (f countingFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	atomic.AddInt32(f.calls, 1)
+	if f.err != nil {
+		return Product{}, f.err
+	}
+	p := f.p
+	p.EAN = ean
+	return p, nil
+}
+
+func (f countingFetcher) IsURLValidForEAN(url, ean string) bool {
+	return f.p.URL == url
+}
+
+func testProductCache(t *testing.T, cacheDB ProductCacheDB, blacklist BlacklistDB) {
+	calls := int32(0)
+	product := Product{Name: "cached", URL: "http://www.example.com/cached", Sources: &ProductSources{Name: "Example.com"}}
+	fetcher := NewCachedFetcher(countingFetcher{calls: &calls, p: product}, cacheDB)
+	ean := "5029053038896"
+	for i := 0; i < 3; i++ {
+		p, err := fetcher.Fetch(context.Background(), ean, blacklist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != product.Name || p.EAN != ean || p.Sources == nil || !reflect.DeepEqual(*p.Sources, *product.Sources) {
+			t.Errorf("Some attributes are invalid for: %v", p)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call to the fetcher, got %v", calls)
+	}
+
+	// expired entries are fetched again
+	fetcher.TTL = -time.Second
+	if err := cacheDB.Delete(ean); err != nil {
+		t.Fatal(err)
+	}
+	fetcher.Fetch(context.Background(), ean, blacklist)
+	fetcher.Fetch(context.Background(), ean, blacklist)
+	if calls != 3 {
+		t.Errorf("expected 3 calls to the fetcher, got %v", calls)
+	}
+
+	// blacklisted urls evict cached entries
+	fetcher.TTL = time.Hour
+	fetcher.Fetch(context.Background(), ean, blacklist)
+	if err := blacklist.Add(product.URL); err != nil {
+		t.Fatal(err)
+	}
+	fetcher.Fetch(context.Background(), ean, blacklist)
+	if calls != 5 {
+		t.Errorf("expected 5 calls to the fetcher, got %v", calls)
+	}
+
+	// lookups are cached by normalized barcode, a UPC-A shares the entry of its EAN-13
+	upcCalls := int32(0)
+	upc := NewCachedFetcher(countingFetcher{calls: &upcCalls, p: Product{Name: "upc", URL: "http://www.example.com/upc"}}, cacheDB)
+	for _, code := range []string{"036000291452", "0036000291452"} {
+		if _, err := upc.Fetch(context.Background(), code, blacklist); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upcCalls != 1 {
+		t.Errorf("expected 1 call to the fetcher, got %v", upcCalls)
+	}
+
+	// blacklisting any source of a merged product evicts it
+	mergedCalls := int32(0)
+	source := "http://www.example.com/image"
+	merged := NewCachedFetcher(countingFetcher{calls: &mergedCalls, p: Product{Name: "merged", URL: "http://www.example.com/merged",
+		Sources: &ProductSources{Name: "Example.com", ImageURL: "Image.com", URLs: []string{"http://www.example.com/merged", source}}}}, cacheDB)
+	mergedEAN := "3270160891382"
+	merged.Fetch(context.Background(), mergedEAN, blacklist)
+	if err := blacklist.Add(source); err != nil {
+		t.Fatal(err)
+	}
+	merged.Fetch(context.Background(), mergedEAN, blacklist)
+	if mergedCalls != 2 {
+		t.Errorf("expected 2 calls to the fetcher, got %v", mergedCalls)
+	}
+
+	// not found outcomes are cached, other errors are not
+	notFoundCalls := int32(0)
+	notFound := NewCachedFetcher(countingFetcher{calls: &notFoundCalls, err: fetchErrors{newProductError(ean, "http://www.example.com", errNotFound)}}, cacheDB)
+	notFoundEAN := "4006381333634"
+	for i := 0; i < 2; i++ {
+		if _, err := notFound.Fetch(context.Background(), notFoundEAN, blacklist); !isNotFound(err) {
+			t.Errorf("expected not found error, got %v", err)
+		}
+	}
+	if notFoundCalls != 1 {
+		t.Errorf("expected 1 call to the fetcher, got %v", notFoundCalls)
+	}
+	if c, ok, err := cacheDB.Get(notFoundEAN); err != nil {
+		t.Fatal(err)
+	} else if !ok || c.Found || c.ExpiresAt.After(time.Now().Add(DefaultNotFoundCacheTTL)) {
+		t.Errorf("invalid cached not found entry: %v", c)
+	}
+
+	failingCalls := int32(0)
+	failing := NewCachedFetcher(countingFetcher{calls: &failingCalls, err: fetchErrors{newProductError(ean, "http://www.example.com", errTooManyProducts)}}, cacheDB)
+	failingEAN := "7613034383808"
+	failing.Fetch(context.Background(), failingEAN, blacklist)
+	failing.Fetch(context.Background(), failingEAN, blacklist)
+	if failingCalls != 2 {
+		t.Errorf("expected 2 calls to the fetcher, got %v", failingCalls)
+	}
+
+	if err := cacheDB.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := cacheDB.Get(notFoundEAN); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("cache not purged")
+	}
+}
+
+func TestMemoryProductCache(t *testing.T) {
+	db := NewMemoryDB()
+	testProductCache(t, NewMemoryProductCacheDB(db), NewMemoryBlacklistDB(db))
+}
+
+func TestSQLProductCache(t *testing.T) {
+	db := createSQLTestDB(t)
+	defer db.Close()
+	testProductCache(t, NewSQLProductCacheDB(db), NewSQLBlacklistDB(db))
+}
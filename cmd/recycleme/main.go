@@ -1,27 +1,48 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/jfyuen/recycleme"
 	"gopkg.in/mgo.v2"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var jsonFlag = flag.Bool("json", false, "Print json export")
 var serverFlag = flag.Bool("server", false, "Run in server mode, serving json (EAN as input is useless)")
 var serverPort = flag.String("p", "8080", "Port to listen to")
+var dbFlag = flag.String("db", "mongo", "Database backend to use: mongo, sqlite or memory")
+var graceFlag = flag.Duration("grace", recycleme.DefaultGraceWindow, "How long to wait for better products once a first one is found")
+var deadlineFlag = flag.Duration("deadline", recycleme.DefaultDeadline, "Return the first product found after this deadline")
+var prioritiesFlag = flag.String("priorities", "", "Fetcher priorities overriding the default ones, as name=priority,name=priority (e.g. local=10,OpenFoodFacts=5)")
+var mergeFlag = flag.Bool("merge", false, "Merge product fields (name, image, website) found by several fetchers")
+var cacheTTLFlag = flag.Duration("cache-ttl", recycleme.DefaultCacheTTL, "How long to cache products found, 0 to disable the cache")
+var notFoundTTLFlag = flag.Duration("not-found-ttl", recycleme.DefaultNotFoundCacheTTL, "How long to cache products not found")
+var healthFlag = flag.Bool("health", false, "Print the state of each source after the lookup")
+var userAgentFlag = flag.String("user-agent", recycleme.UserAgent, "User-Agent sent to scraped websites")
+var robotsFlag = flag.Bool("robots", false, "Respect robots.txt rules of scraped websites")
+var rateFlag = flag.Float64("rate", recycleme.DefaultRateLimit.PerSecond, "Maximum requests per second sent to each website")
+var retriesFlag = flag.Int("retries", recycleme.DefaultRetryPolicy.MaxAttempts, "Maximum requests sent to a website when it fails transiently (timeout, 429, 5xx)")
+var materialTagsFlag = flag.String("material-tags", "", "Json file of packaging tags to material names, replacing the default ones, to suggest the materials of unknown packages")
+var regionFlag = flag.String("region", "", "Region whose bins are used, as comma separated codes (e.g. FR-75011), the default region of requests in server mode")
+var dateFlag = flag.String("date", "", "Date of the bin rules to use (2006-01-02), today by default")
+var dataFlag = flag.String("data", "", "Directory with bins.json, materials.json, materials_to_bins.json, preparations.json, packages.json and local_products.json to load in the memory db")
 
 func init() {
 	flag.Usage = func() {
 		name := path.Base(os.Args[0])
 		fmt.Fprintf(os.Stderr, "Usage: %s -d DIR [options] EAN:\n", name)
+		fmt.Fprintf(os.Stderr, "       %s -db=sqlite migrate: apply sql schema migrations\n", name)
+		fmt.Fprintf(os.Stderr, "       %s purge-cache: delete all cached product lookups\n", name)
 		flag.PrintDefaults()
 	}
 }
@@ -36,6 +57,97 @@ func NewMgoDB(url string) (*mgo.Session, error) {
 	return mongoSession, err
 }
 
+// NewMemoryDB loads json files from dir in memory, missing files are skipped
+func NewMemoryDB(dir string) (*recycleme.MemoryDB, error) {
+	db := recycleme.NewMemoryDB()
+	if dir == "" {
+		return db, nil
+	}
+	loaders := []struct {
+		filename string
+		load     func(io.Reader) error
+	}{
+		{"bins.json", db.LoadBins},
+		{"materials.json", db.LoadMaterials},
+		{"materials_to_bins.json", db.LoadMaterialsToBins},
+		{"preparations.json", db.LoadPreparations},
+		{"packages.json", db.LoadPackages},
+		{"local_products.json", db.LoadLocalProducts},
+	}
+	for _, l := range loaders {
+		f, err := os.Open(path.Join(dir, l.filename))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		err = l.load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot load %v: %v", l.filename, err)
+		}
+	}
+	return db, nil
+}
+
+// parsePriorities parses name=priority,name=priority
+func parsePriorities(s string) (map[string]int, error) {
+	priorities := make(map[string]int)
+	if s == "" {
+		return priorities, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid priority %v, expected name=priority", kv)
+		}
+		priority, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority %v: %v", kv, err)
+		}
+		priorities[parts[0]] = priority
+	}
+	return priorities, nil
+}
+
+// formatBin returns the bin, how it is collected, its instructions and its materials, e.g.
+// Bac à couvercle jaune (#f7d117, kerbside): Boîte carton. bien vidés, inutile de les laver
+func formatBin(b recycleme.BinMaterials) string {
+	var details []string
+	for _, d := range []string{b.Color, string(b.CollectionType)} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	s := b.Name
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	names := make([]string, len(b.Materials))
+	for i, m := range b.Materials {
+		names[i] = m.Name
+	}
+	s += ": " + strings.Join(names, ", ")
+	if b.Instructions != "" {
+		s += ". " + b.Instructions
+	}
+	return s
+}
+
+// formatDisposal returns the numbered preparation steps and the warnings of a material, e.g.
+// Bouteille plastique: 1. vider la bouteille 2. laisser le bouchon. Attention: ne pas écraser
+func formatDisposal(d recycleme.MaterialDisposal) string {
+	s := d.Material.Name + ":"
+	for i, step := range d.Steps {
+		s += fmt.Sprintf(" %d. %s", i+1, step)
+	}
+	if len(d.Warnings) > 0 {
+		s += ". Attention: " + strings.Join(d.Warnings, ", ")
+	}
+	return s
+}
+
 func noCacheHandle(path string, h http.Handler) {
 	http.Handle(path, recycleme.NoCacheHandle(h))
 }
@@ -49,20 +161,121 @@ func main() {
 
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
-	mongoSession, err := NewMgoDB(os.Getenv("RECYCLEME_MONGO_URI"))
+	var packageDB recycleme.RulesDB
+	var blacklistDB recycleme.BlacklistDB
+	var localProductDB recycleme.Fetcher
+	var cacheDB recycleme.ProductCacheDB
+	migrate := !*serverFlag && flag.Arg(0) == "migrate"
+	if migrate && *dbFlag != "sqlite" {
+		logger.Fatalf("migrate is only available with -db=sqlite")
+	}
+
+	switch *dbFlag {
+	case "mongo":
+		mongoSession, err := NewMgoDB(os.Getenv("RECYCLEME_MONGO_URI"))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer mongoSession.Close()
+
+		packageDB = recycleme.NewMgoPackageDB(mongoSession, "")
+		blacklistDB = recycleme.NewMgoBlacklistDB(mongoSession, "")
+		localProductDB = recycleme.NewMgoLocalProductDB(mongoSession, "")
+		cacheDB = recycleme.NewMgoProductCacheDB(mongoSession, "")
+	case "memory":
+		memoryDB, err := NewMemoryDB(*dataFlag)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		packageDB = recycleme.NewMemoryPackageDB(memoryDB)
+		blacklistDB = recycleme.NewMemoryBlacklistDB(memoryDB)
+		localProductDB = recycleme.NewMemoryLocalProductDB(memoryDB)
+		cacheDB = recycleme.NewMemoryProductCacheDB(memoryDB)
+	case "sqlite":
+		sqlDB, err := recycleme.OpenSQLDB(os.Getenv("RECYCLEME_SQL_URI"))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer sqlDB.Close()
+
+		if migrate {
+			applied, err := recycleme.MigrateSQLDB(sqlDB)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			logger.Printf("%v migrations applied", applied)
+			return
+		}
+		if err := recycleme.CheckSQLSchema(sqlDB); err != nil {
+			logger.Fatal(err)
+		}
+
+		packageDB = recycleme.NewSQLPackageDB(sqlDB)
+		blacklistDB = recycleme.NewSQLBlacklistDB(sqlDB)
+		localProductDB = recycleme.NewSQLLocalProductDB(sqlDB)
+		cacheDB = recycleme.NewSQLProductCacheDB(sqlDB)
+	default:
+		logger.Fatalf("unknown db %v, must be mongo, sqlite or memory", *dbFlag)
+	}
+
+	if !*serverFlag && flag.Arg(0) == "purge-cache" {
+		if err := cacheDB.Purge(); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Println("product cache purged")
+		return
+	}
+
+	recycleme.UserAgent = *userAgentFlag
+	recycleme.RespectRobotsTxt = *robotsFlag
+	recycleme.DefaultRateLimit.PerSecond = *rateFlag
+	recycleme.DefaultRetryPolicy.MaxAttempts = *retriesFlag
+	if *materialTagsFlag != "" {
+		f, err := os.Open(*materialTagsFlag)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		recycleme.MaterialTags, err = recycleme.LoadMaterialTags(f)
+		f.Close()
+		if err != nil {
+			logger.Fatalln(err)
+		}
+	}
+
+	region, err := recycleme.ParseRegion(*regionFlag)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	defer mongoSession.Close()
-
-	packageDB := recycleme.NewMgoPackageDB(mongoSession, "")
-	blacklistDB := recycleme.NewMgoBlacklistDB(mongoSession, "")
+	date := time.Now()
+	if *dateFlag != "" {
+		if date, err = recycleme.ParseDate(*dateFlag); err != nil {
+			logger.Fatal(err)
+		}
+	}
 
-	localProductDB := recycleme.NewMgoLocalProductDB(mongoSession, "")
-	fetcher, err := recycleme.NewDefaultFetcher(localProductDB)
+	defaultFetcher, err := recycleme.NewDefaultFetcher(localProductDB)
 	if err != nil {
 		logger.Println(err.Error())
 	}
+	priorities, err := parsePriorities(*prioritiesFlag)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for name, priority := range priorities {
+		defaultFetcher.Priorities[name] = priority
+	}
+	defaultFetcher.GraceWindow = *graceFlag
+	defaultFetcher.Deadline = *deadlineFlag
+	defaultFetcher.Merge = *mergeFlag
+
+	var fetcher recycleme.Fetcher = defaultFetcher
+	if *cacheTTLFlag > 0 {
+		cachedFetcher := recycleme.NewCachedFetcher(defaultFetcher, cacheDB)
+		cachedFetcher.TTL = *cacheTTLFlag
+		cachedFetcher.NotFoundTTL = *notFoundTTLFlag
+		cachedFetcher.Logger = logger
+		fetcher = cachedFetcher
+	}
 
 	if *serverFlag {
 		emailConfig, err := recycleme.NewEmailConfig(os.Getenv("RECYCLEME_MAIL_HOST"), os.Getenv("RECYCLEME_MAIL_RECIPIENT"), os.Getenv("RECYCLEME_MAIL_USERNAME"), os.Getenv("RECYCLEME_MAIL_PASSWORD"))
@@ -79,7 +292,15 @@ func main() {
 		noCacheHandle("/materials/", recycleme.MaterialsHandler{DB: packageDB})
 		noCacheHandle("/package/add", recycleme.AddPackageHandler{DB: packageDB, Logger: logger, Mailer: mailHandler})
 		noCacheHandle("/blacklist/add", recycleme.AddBlacklistHandler{Blacklist: blacklistDB, Logger: logger, Fetcher: fetcher, Mailer: mailHandler})
-		noCacheHandle("/throwaway/", recycleme.ThrowAwayHandler{DB: packageDB, BlacklistDB: blacklistDB, Fetcher: fetcher})
+		noCacheHandle("/throwaway/", recycleme.ThrowAwayHandler{DB: packageDB, BlacklistDB: blacklistDB, Fetcher: fetcher, Materials: packageDB, Region: region})
+		noCacheHandle("/rules/upcoming", recycleme.UpcomingRulesHandler{DB: packageDB, Region: region})
+		if adminToken := os.Getenv("RECYCLEME_ADMIN_TOKEN"); adminToken != "" {
+			noCacheHandle("/cache/purge", recycleme.AdminHandle(adminToken, recycleme.PurgeCacheHandler{Cache: cacheDB, Logger: logger}))
+			noCacheHandle("/rules/stage", recycleme.AdminHandle(adminToken, recycleme.StageRulesHandler{DB: packageDB, Logger: logger, Mailer: mailHandler}))
+		} else {
+			logger.Println("RECYCLEME_ADMIN_TOKEN not set, admin actions are disabled")
+		}
+		noCacheHandle("/sources/health", recycleme.SourcesHealthHandler{Fetcher: defaultFetcher})
 		noCacheHandle("/", recycleme.HomeHandler{})
 
 		fs := http.FileServer(http.Dir("static"))
@@ -91,26 +312,61 @@ func main() {
 			logger.Fatalln(err)
 		}
 	} else {
-		product, err := fetcher.Fetch(flag.Arg(0), blacklistDB)
+		ean, err := recycleme.NormalizeBarcode(flag.Arg(0))
 		if err != nil {
+			logger.Fatalf("invalid barcode %v: %v", flag.Arg(0), err)
+		}
+		product, err := fetcher.Fetch(context.Background(), ean, blacklistDB)
+		if *healthFlag {
+			for _, h := range defaultFetcher.Health() {
+				logger.Printf("%v: %v (%v successes, %v failures) %v", h.Name, h.State, h.Successes, h.Failures, h.LastError)
+			}
+		}
+		if err != nil {
+			if info, decodeErr := recycleme.DecodeBarcode(ean); decodeErr == nil && info.Notice() != "" {
+				logger.Println(info.Notice())
+			}
 			logger.Fatalln(err)
 		}
 		pkg, err := recycleme.NewProductPackage(product, packageDB)
 		if err != nil {
 			logger.Fatalln(err)
 		}
-		throwaway, err := pkg.ThrowAway(packageDB)
-		if err != nil {
+		if pkg.Barcode != nil && pkg.Barcode.Country != "" {
+			logger.Println(fmt.Sprintf("%v code registered in %v", pkg.Barcode.Category, pkg.Barcode.Country))
+		} else if pkg.Barcode != nil {
+			logger.Println(fmt.Sprintf("%v code", pkg.Barcode.Category))
+		}
+		if err := pkg.SuggestMaterials(packageDB); err != nil {
 			logger.Fatalln(err)
 		}
+		if len(pkg.SuggestedMaterials) > 0 {
+			logger.Println(fmt.Sprintf("Unknown package, suggested materials: %v", pkg.SuggestedMaterials))
+		}
 		if *jsonFlag {
-			jsonBytes, err := json.Marshal(throwaway)
+			// the same json as /throwaway/
+			jsonBytes, err := pkg.ThrowAwayJSON(packageDB, region, date)
 			if err != nil {
 				logger.Fatalln(err)
 			}
 			logger.Println(string(jsonBytes))
-		} else {
-			logger.Println(throwaway)
+			return
+		}
+		throwaway, err := pkg.ThrowAway(packageDB, region, date)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		preparations, err := packageDB.GetPreparations(pkg.Materials, region)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		for _, b := range recycleme.GroupByBin(throwaway) {
+			logger.Println(formatBin(b))
+		}
+		for _, d := range recycleme.DisposalPlan(pkg.Materials, throwaway, preparations) {
+			if len(d.Steps) > 0 || len(d.Warnings) > 0 {
+				logger.Println(formatDisposal(d))
+			}
 		}
 	}
 }
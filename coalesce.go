@@ -0,0 +1,77 @@
+package recycleme
+
+import (
+	"context"
+	"sync"
+)
+
+// flight is an in-flight call, shared by all callers waiting for the same key
+type flight struct {
+	done    chan struct{}
+	v       interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup coalesces concurrent calls with the same key (e.g. lookups of the same EAN): only one is run,
+// and all callers receive its result or error.
+// The shared call is not bound to the context of the first caller, it is only cancelled once all callers are gone,
+// unless the group is detached: its calls then always run to completion (e.g. to cache their result) and are joined by new callers.
+type flightGroup struct {
+	mu       sync.Mutex
+	flights  map[string]*flight
+	detached bool
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// do coalesces lookups of Products, see run
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (Product, error)) (Product, error) {
+	v, err := g.run(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return fn(ctx)
+	})
+	p, _ := v.(Product)
+	return p, err
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	fl, ok := g.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.Background())
+		fl = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = fl
+		go func() {
+			fl.v, fl.err = fn(flightCtx)
+			g.mu.Lock()
+			if g.flights[key] == fl {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(fl.done)
+		}()
+	}
+	fl.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-fl.done:
+		return fl.v, fl.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		fl.waiters--
+		if fl.waiters == 0 && !g.detached {
+			// nobody is waiting anymore, new callers must not join a cancelled call
+			fl.cancel()
+			if g.flights[key] == fl {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+package recycleme
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedFetcher counts calls to Fetch, and waits for release before returning its Product or error
+type gatedFetcher struct {
+	countingFetcher
+	release chan struct{}
+}
+
+func (f gatedFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return Product{}, ctx.Err()
+	}
+	return f.countingFetcher.Fetch(ctx, ean, db)
+}
+
+func TestDefaultFetcherCoalescing(t *testing.T) {
+	calls := int32(0)
+	gated := gatedFetcher{countingFetcher: countingFetcher{calls: &calls, p: Product{Name: "coalesced"}}, release: make(chan struct{})}
+	fetcher := DefaultFetcher{fetchers: []Fetcher{gated}, flights: newFlightGroup()}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+			if err != nil {
+				t.Error(err)
+			} else if p.Name != "coalesced" {
+				t.Errorf("Some attributes are invalid for: %v", p)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gated.release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expected 1 call to the fetcher, got %v", calls)
+	}
+
+	// once done, a new lookup is run
+	if _, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls to the fetcher, got %v", calls)
+	}
+
+	// errors are shared too
+	errCalls := int32(0)
+	failing := gatedFetcher{countingFetcher: countingFetcher{calls: &errCalls, err: newProductError("5029053038896", "failing", errNotFound)}, release: make(chan struct{})}
+	fetcher = DefaultFetcher{fetchers: []Fetcher{failing}, flights: newFlightGroup()}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB); !isNotFound(err) {
+				t.Errorf("expected not found error, got %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(failing.release)
+	wg.Wait()
+	if errCalls != 1 {
+		t.Errorf("expected 1 call to the fetcher, got %v", errCalls)
+	}
+}
+
+func TestFlightGroupCancel(t *testing.T) {
+	g := newFlightGroup()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (Product, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return Product{}, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.do(ctx1, "ean", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.do(ctx2, "ean", func(ctx context.Context) (Product, error) {
+			t.Error("lookup should be shared")
+			return Product{}, nil
+		})
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the lookup goes on while someone is waiting for it
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("lookup cancelled while still waited for")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("lookup not cancelled once nobody waits for it")
+	}
+
+	calls := int32(0)
+	if _, err := g.do(context.Background(), "ean", func(ctx context.Context) (Product, error) {
+		atomic.AddInt32(&calls, 1)
+		return Product{}, nil
+	}); err != nil || calls != 1 {
+		t.Errorf("new lookup should not join a cancelled one: %v, %v calls", err, calls)
+	}
+}
@@ -3,6 +3,8 @@ package recycleme
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 var errNotFound = fmt.Errorf("product not found")
@@ -10,16 +12,126 @@ var errInvalidEAN = fmt.Errorf("invalid ean")
 var errBlacklisted = fmt.Errorf("product blacklisted for url")
 var errTooManyProducts = fmt.Errorf("too many products found")
 var errPackageNotFound = errors.New("ean not found in packages db")
+var errRateLimited = errors.New("rate limited, retry later")
+var errThrottled = errors.New("throttled by the website, retry later")
+var errDisallowedByRobots = errors.New("disallowed by robots.txt")
+var errUnavailable = errors.New("source unavailable")
+var errInvalidRegion = errors.New("invalid region")
+var errInvalidBinRule = errors.New("invalid bin rule")
+var errInvalidMaterial = errors.New("invalid material")
+var errUnauthorized = errors.New("unauthorized")
 
+// httpStatusError is returned when a website answers with an unexpected status code
+// RetryAfter is set if the website asked to wait before retrying (429 or 503).
+type httpStatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (err *httpStatusError) Error() string {
+	return fmt.Sprintf("error while processing product %v, received code %v", err.URL, err.StatusCode)
+}
+
+// productError is an error while fetching a Product, Attempts is the number of requests sent if more than one
 type productError struct {
 	EAN, URL string
+	Attempts int
 	err      error
 }
 
 func (err productError) Error() string {
+	if err.Attempts > 1 {
+		return fmt.Sprintf("%v for %v at %v after %v attempts", err.err, err.EAN, err.URL, err.Attempts)
+	}
 	return fmt.Sprintf("%v for %v at %v", err.err, err.EAN, err.URL)
 }
 
+// Unwrap returns the cause of the error, so errors.Is(err, errNotFound) can be used
+func (err productError) Unwrap() error {
+	return err.err
+}
+
+// Is matches errUnavailable if the source is down (network errors, 5xx, open circuit) or rate limited
+func (err productError) Is(target error) bool {
+	return target == errUnavailable && (isSourceFailure(err.err) || err.err == errCircuitOpen || err.err == errRateLimited)
+}
+
 func newProductError(ean, url string, err error) *productError {
 	return &productError{EAN: ean, URL: url, err: err}
 }
+
+// fetchErrors are the errors of all fetchers when no product was found, one productError per source.
+// With errors.Is, errNotFound and errUnavailable match if they apply to all sources (the product is nowhere, or all sources are down),
+// other errors (errBlacklisted, errTooManyProducts, ...) match if any source returned them.
+type fetchErrors []error
+
+func (errs fetchErrors) Error() string {
+	errStr := make([]string, 1, len(errs)+1)
+	errStr[0] = ""
+	rateLimited := 0
+	for _, err := range errs {
+		errStr = append(errStr, err.Error())
+		if isRateLimited(err) {
+			rateLimited++
+		}
+	}
+	if rateLimited > 0 {
+		return fmt.Sprintf("no product found, %v sources rate limited, because of the following errors:%v", rateLimited, strings.Join(errStr, "\n - "))
+	}
+	return fmt.Sprintf("no product found because of the following errors:%v", strings.Join(errStr, "\n - "))
+}
+
+func (errs fetchErrors) Is(target error) bool {
+	switch target {
+	case errNotFound:
+		for _, err := range errs {
+			if !isNotFound(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case errUnavailable:
+		for _, err := range errs {
+			if !errors.Is(err, errUnavailable) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// missing returns true if all sources answered without a usable product: not found, blacklisted or too many products.
+// If any source failed otherwise (unavailable, rate limited, ...), the product may exist.
+func (errs fetchErrors) missing() bool {
+	for _, err := range errs {
+		if !isNotFound(err) && !errors.Is(err, errBlacklisted) && !errors.Is(err, errTooManyProducts) {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
+
+// isNotFound returns true if the product was not found, and not because of another error (network, blacklist, ...)
+func isNotFound(err error) bool {
+	var errs fetchErrors
+	if errors.As(err, &errs) {
+		return errs.Is(errNotFound)
+	}
+	// a source which cannot represent the barcode cannot have the product either
+	return errors.Is(err, errNotFound) || errors.Is(err, errUnsupportedBarcode)
+}
+
+// isRateLimited returns true if the product could not be fetched because we sent too many requests
+func isRateLimited(err error) bool {
+	if pErr, ok := err.(*productError); ok {
+		return pErr.err == errRateLimited
+	}
+	return err == errRateLimited
+}
@@ -0,0 +1,84 @@
+package recycleme
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestProductErrorUnwrap(t *testing.T) {
+	err := error(newProductError("5029053038896", "http://www.example.com", errBlacklisted))
+	if !errors.Is(err, errBlacklisted) || errors.Is(err, errNotFound) {
+		t.Errorf("%v should only match %v", err, errBlacklisted)
+	}
+	down := newProductError("5029053038896", "http://www.example.com", &httpStatusError{URL: "http://www.example.com", StatusCode: 503})
+	var statusErr *httpStatusError
+	if !errors.As(down, &statusErr) || statusErr.StatusCode != 503 || !errors.Is(down, errUnavailable) {
+		t.Errorf("%v should be an unavailable source", down)
+	}
+	if errors.Is(err, errUnavailable) {
+		t.Errorf("%v should not be an unavailable source", err)
+	}
+}
+
+func TestFetchErrorsIs(t *testing.T) {
+	notFound := newProductError("5029053038896", "a", errNotFound)
+	unsupported := newProductError("5029053038896", "b", errUnsupportedBarcode)
+	blacklisted := newProductError("5029053038896", "c", errBlacklisted)
+	down := newProductError("5029053038896", "d", errCircuitOpen)
+	rateLimited := newProductError("5029053038896", "e", errRateLimited)
+	throttled := newProductError("5029053038896", "g", errThrottled)
+
+	for _, test := range []struct {
+		errs                                        fetchErrors
+		notFound, unavailable, blacklisted, tooMany bool
+	}{
+		{fetchErrors{notFound, unsupported}, true, false, false, false},
+		{fetchErrors{notFound, blacklisted}, false, false, true, false},
+		{fetchErrors{down, rateLimited}, false, true, false, false},
+		{fetchErrors{throttled, rateLimited}, false, true, false, false},
+		{fetchErrors{notFound, down}, false, false, false, false},
+		{fetchErrors{notFound, newProductError("5029053038896", "f", errTooManyProducts)}, false, false, false, true},
+		{fetchErrors{}, false, false, false, false},
+	} {
+		// wrapping must not change anything
+		for _, err := range []error{test.errs, fmt.Errorf("lookup: %w", test.errs)} {
+			if errors.Is(err, errNotFound) != test.notFound || isNotFound(err) != test.notFound {
+				t.Errorf("%v: not found should be %v", err, test.notFound)
+			}
+			if errors.Is(err, errUnavailable) != test.unavailable {
+				t.Errorf("%v: unavailable should be %v", err, test.unavailable)
+			}
+			if errors.Is(err, errBlacklisted) != test.blacklisted {
+				t.Errorf("%v: blacklisted should be %v", err, test.blacklisted)
+			}
+			if errors.Is(err, errTooManyProducts) != test.tooMany {
+				t.Errorf("%v: too many products should be %v", err, test.tooMany)
+			}
+		}
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{errInvalidEAN, http.StatusBadRequest},
+		{fmt.Errorf("%w abc", errInvalidEAN), http.StatusBadRequest},
+		{newProductError("5029053038896", "/cache/", errNotFound), http.StatusNotFound},
+		{fetchErrors{newProductError("5029053038896", "a", errBlacklisted)}, http.StatusNotFound},
+		{fetchErrors{newProductError("5029053038896", "a", errCircuitOpen)}, http.StatusBadGateway},
+		{fetchErrors{newProductError("5029053038896", "a", errNotFound), errors.New("connection reset")}, http.StatusBadGateway},
+		{fetchErrors{newProductError("5029053038896", "a", errBlacklisted), newProductError("5029053038896", "b", errNotFound), newProductError("5029053038896", "c", errTooManyProducts)}, http.StatusNotFound},
+		{fetchErrors{newProductError("5029053038896", "a", errBlacklisted), newProductError("5029053038896", "b", errCircuitOpen), newProductError("5029053038896", "c", &httpStatusError{URL: "c", StatusCode: 503})}, http.StatusBadGateway},
+		{fetchErrors{newProductError("5029053038896", "a", errTooManyProducts), newProductError("5029053038896", "b", errRateLimited)}, http.StatusBadGateway},
+		{errPackageNotFound, http.StatusNotFound},
+		{errors.New("database is down"), http.StatusInternalServerError},
+	} {
+		if status := errorStatus(test.err); status != test.status {
+			t.Errorf("%v: expected status %v, got %v", test.err, test.status, status)
+		}
+	}
+}
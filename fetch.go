@@ -1,24 +1,16 @@
 package recycleme
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"encoding/json"
-	"encoding/xml"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	eancheck "github.com/nicholassm/go-ean"
-	"golang.org/x/net/html"
-	"golang.org/x/text/encoding/charmap"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -30,6 +22,47 @@ type Product struct {
 	ImageURL    string `json:"image_url" bson:"image_url"`       // URL where to find an image of the Product
 	WebsiteURL  string `json:"website_url" bson:"website_url"`   // URL where to find the details of the Product
 	WebsiteName string `json:"website_name" bson:"website_name"` // Website name
+
+	Packaging *PackagingData  `json:"packaging,omitempty" bson:"packaging,omitempty"` // Packaging of the Product, if the website describes it
+	Sources   *ProductSources `json:"sources,omitempty" bson:"sources,omitempty"`     // Website names which supplied each field, when merged from several fetchers
+}
+
+// PackagingData is the packaging of a Product as described by a website, e.g. OpenFoodFacts:
+// a free text, tags (e.g. en:plastic-bottle) and parts of the packaging
+type PackagingData struct {
+	Text  string          `json:"text,omitempty" bson:"text,omitempty"`
+	Tags  []string        `json:"tags,omitempty" bson:"tags,omitempty"`
+	Parts []PackagingPart `json:"parts,omitempty" bson:"parts,omitempty"`
+}
+
+// PackagingPart is a part of a packaging, each field is a tag (e.g. en:bottle, en:plastic, en:recycle)
+type PackagingPart struct {
+	Shape     string `json:"shape,omitempty" bson:"shape,omitempty"`
+	Material  string `json:"material,omitempty" bson:"material,omitempty"`
+	Recycling string `json:"recycling,omitempty" bson:"recycling,omitempty"`
+}
+
+// ProductSources records which website supplied each field of a Product merged from several fetchers
+type ProductSources struct {
+	Name       string `json:"name,omitempty" bson:"name,omitempty"`
+	ImageURL   string `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	WebsiteURL string `json:"website_url,omitempty" bson:"website_url,omitempty"`
+	Packaging  string `json:"packaging,omitempty" bson:"packaging,omitempty"`
+	// URLs where the merged fields were found
+	URLs []string `json:"urls,omitempty" bson:"urls,omitempty"`
+}
+
+// urls returns the URL of the Product and the URLs of its sources, if merged
+func (p Product) urls() []string {
+	urls := []string{p.URL}
+	if p.Sources != nil {
+		for _, url := range p.Sources.URLs {
+			if url != p.URL {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
 }
 
 func (p Product) String() string {
@@ -45,25 +78,37 @@ func (p Product) JSON() ([]byte, error) {
 }
 
 // UpcItemDbFetcher for upcitemdb.com
-var UpcItemDbFetcher, _ = NewFetchableURL("http://www.upcitemdb.com/upc/%s", "UPCItemDB", upcItemDbParser{})
+var UpcItemDbFetcher, _ = NewScraperFetcher(upcItemDbScraper)
 
 // OpenFoodFactsFetcher for openfoodfacts.org (using json api)
-var OpenFoodFactsFetcher, _ = NewFetchableURL("http://fr.openfoodfacts.org/api/v0/produit/%s.json", "OpenFoodFacts", openFoodFactsParser{})
+var OpenFoodFactsFetcher, _ = NewScraperFetcher(openFoodFactsScraper)
+
+// OpenBeautyFactsFetcher for openbeautyfacts.org, cosmetics (using json api)
+var OpenBeautyFactsFetcher, _ = NewScraperFetcher(openBeautyFactsScraper)
+
+// OpenProductsFactsFetcher for openproductsfacts.org, household and other products (using json api)
+var OpenProductsFactsFetcher, _ = NewScraperFetcher(openProductsFactsScraper)
+
+// OpenPetFoodFactsFetcher for openpetfoodfacts.org, pet food (using json api)
+var OpenPetFoodFactsFetcher, _ = NewScraperFetcher(openPetFoodFactsScraper)
+
+// IsbnSearchFetcher for isbnsearch.org, books
+var IsbnSearchFetcher, _ = NewScraperFetcher(isbnSearchScraper)
 
 // IGalerieFetcher for some unknown website: http://90.80.54.225/?img=161277&images=1859
-var IGalerieFetcher, _ = NewFetchableURL("http://90.80.54.225/?search=%s", "90.80.54.225", iGalerieParser{baseURL: "http://90.80.54.225/"})
+var IGalerieFetcher, _ = NewScraperFetcher(iGalerieScraper)
 
 // StarrymartFetcher for starrymart.co.uk
-var StarrymartFetcher, _ = NewFetchableURL("https://starrymart.co.uk/catalogsearch/result/?q=%s", "StarryMart", starrymartParser{})
+var StarrymartFetcher, _ = NewScraperFetcher(starrymartScraper)
 
 // MisterPharmaWebFetcher for misterpharmaweb.com
-var MisterPharmaWebFetcher, _ = NewFetchableURL("http://www.misterpharmaweb.com/recherche-resultats.php?search_in_description=1&ac_keywords=%s", "MisterPharmaWeb", misterPharmaWebParser{baseURL: "http://www.misterpharmaweb.com/"})
+var MisterPharmaWebFetcher, _ = NewScraperFetcher(misterPharmaWebScraper)
 
 // MedisparFetcher for meddispar.fr
-var MedisparFetcher, _ = NewFetchableURL("http://www.meddispar.fr/content/search?search_by_name=&search_by_cip=%s", "Medispar", medisparParser{baseURL: "http://www.meddispar.fr"})
+var MedisparFetcher, _ = NewScraperFetcher(medisparScraper)
 
 // PicardFetcher for picard.fr
-var PicardFetcher, _ = NewFetchableURL("http://www.picard.fr/recherche?q=%s", "Picard", picardParser{baseURL: "http://www.picard.fr"})
+var PicardFetcher, _ = NewScraperFetcher(picardScraper)
 
 type BlacklistDB interface {
 	Contains(url string) (bool, error)
@@ -104,12 +149,28 @@ func (db mgoBlacklistDB) Add(url string) error {
 }
 
 // Fetcher query something (URL, database, ...) with EAN, and return the Product stored or scrapped
-// It should check if the requested URL is in the blacklist
+// It should check if the requested URL is in the blacklist, and stop as soon as ctx is done
 type Fetcher interface {
-	Fetch(ean string, db BlacklistDB) (Product, error)
+	Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error)
 	IsURLValidForEAN(url, ean string) bool
 }
 
+// LocalFetcherName is the name of fetchers looking into our own local_products
+const LocalFetcherName = "local"
+
+// namedFetcher is a Fetcher with a name, to configure it (priorities, ...) or report on it
+type namedFetcher interface {
+	Name() string
+}
+
+// fetcherName returns the name of a Fetcher, or its type if it has none
+func fetcherName(f Fetcher) string {
+	if nf, ok := f.(namedFetcher); ok {
+		return nf.Name()
+	}
+	return fmt.Sprintf("%T", f)
+}
+
 type HTMLParser interface {
 	ParseBody(b []byte) (Product, error)
 }
@@ -117,10 +178,16 @@ type HTMLParser interface {
 // FetchableURL is a base struct to fetch websites
 // URL that can be used by fetchers, it must be a format string, the %s or %v will be replaced by the EAN
 // WebsiteName is the corporate name given to the website to be fetched, for prettier printing
+// Retry is the policy to retry transient failures (timeouts, 429, 5xx, ...)
+// Barcode is the representation of the EAN expected in URL (UPC-A, ISBN-10, ...), the canonical GTIN by default
+// Categories are the categories of codes the website holds (products, books, ...), all of them if empty
 type FetchableURL struct {
 	URL         string
 	WebsiteName string
 	HTMLParser
+	Retry      RetryPolicy
+	Barcode    BarcodeFormat
+	Categories []BarcodeCategory
 }
 
 // Create a new FetchableURL, checking that it contains the correct format to place the EAN in the URL
@@ -129,7 +196,7 @@ func NewFetchableURL(url string, website string, parser HTMLParser) (FetchableUR
 		return FetchableURL{}, fmt.Errorf("URL %v does not containt format string to insert EAN", url)
 	}
 
-	return FetchableURL{URL: url, WebsiteName: website, HTMLParser: parser}, nil
+	return FetchableURL{URL: url, WebsiteName: website, HTMLParser: parser, Retry: DefaultRetryPolicy}, nil
 }
 
 func fullURL(url, ean string) string {
@@ -140,8 +207,22 @@ var client = http.Client{
 	Timeout: time.Duration(15 * time.Second),
 }
 
-func fetchURL(url string) ([]byte, error) {
-	resp, err := client.Get(url)
+// sendRequest waits for its turn in the rate limit of the host, and sends req with our UserAgent
+func sendRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if err := rateLimiter.wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	return client.Do(req)
+}
+
+// fetchURLOnce fetches url with sendRequest
+func fetchURLOnce(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sendRequest(ctx, req)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -154,7 +235,7 @@ func fetchURL(url string) ([]byte, error) {
 	case 404:
 		return nil, errNotFound
 	default:
-		return nil, fmt.Errorf("error while processing product %v, received code %v", url, resp.StatusCode)
+		return nil, &httpStatusError{URL: url, StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
 	}
 }
 
@@ -174,10 +255,24 @@ func withCheckInBlacklist(b BlacklistDB, ean, url string, fn innerFetchFunc) (Pr
 	return p, nil
 }
 
-func (f FetchableURL) Fetch(ean string, db BlacklistDB) (Product, error) {
-	url := fullURL(f.URL, ean)
-	return withCheckInBlacklist(db, ean, url, func() (Product, error) {
-		body, err := fetchURL(url)
+func (f FetchableURL) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	code, err := FormatBarcode(ean, f.Barcode)
+	if err != nil {
+		return Product{}, newProductError(ean, f.URL, err)
+	}
+	url := fullURL(f.URL, code)
+	attempts := 0
+	p, err := withCheckInBlacklist(db, ean, url, func() (Product, error) {
+		if RespectRobotsTxt {
+			if ok, err := robots.allowed(ctx, url); err != nil {
+				return Product{}, err
+			} else if !ok {
+				return Product{}, errDisallowedByRobots
+			}
+		}
+		var body []byte
+		var err error
+		body, attempts, err = fetchURL(ctx, url, f.Retry)
 		if err != nil {
 			return Product{}, err
 		}
@@ -193,270 +288,31 @@ func (f FetchableURL) Fetch(ean string, db BlacklistDB) (Product, error) {
 		p.WebsiteName = f.WebsiteName
 		return p, nil
 	})
-}
-
-func (f FetchableURL) IsURLValidForEAN(url, ean string) bool {
-	return fullURL(f.URL, ean) == url
-}
-
-type iGalerieParser struct{ baseURL string }
-
-func (f iGalerieParser) ParseBody(b []byte) (Product, error) {
-	doc, err := html.Parse(bytes.NewReader(b))
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				switch c.Data {
-				// Looking for <div id="search_result"><p id="search_result_img">1 image trouvée :</p></div>
-				case "div":
-					if len(c.Attr) == 1 {
-						classAttr := c.Attr[0]
-						if classAttr.Key == "id" && classAttr.Val == "search_result" {
-							if c.FirstChild != nil && c.FirstChild.NextSibling != nil && c.FirstChild.NextSibling.FirstChild != nil {
-								txt := c.FirstChild.NextSibling.FirstChild
-								if txt.Type == html.TextNode && !strings.Contains(txt.Data, "1 image trouv") {
-									err = errTooManyProducts
-									return
-								}
-							}
-						}
-					}
-				// image link is stored in style attribute
-				case "a":
-					if len(c.Attr) == 3 {
-						isProduct := false
-						for _, attr := range c.Attr {
-							if attr.Key == "class" && strings.Contains(attr.Val, "img_link") {
-								isProduct = true
-							}
-							if attr.Key == "style" && isProduct && len(p.ImageURL) == 0 && strings.Contains(attr.Val, "background:url") {
-								imageURL := strings.Replace(attr.Val, "background:url(/getimg.php?img=", "", 1)
-								imageURL = strings.Replace(imageURL, ") no-repeat center", "", 1)
-								imageURL = strings.Split(f.baseURL, "?")[0] + "albums/" + imageURL
-								p.ImageURL = imageURL
-							}
-						}
-					}
-				}
-				if p.ImageURL != "" {
-					return
-				}
-				fn(c)
-			}
-		}
-	}
-	fn(doc)
-	if err != nil {
-		return p, err
+	if pErr, ok := err.(*productError); ok {
+		pErr.Attempts = attempts
 	}
-	if p.ImageURL == "" {
-		return p, errNotFound
-	}
-	return p, nil
-}
-
-type upcItemDbParser struct{}
-
-func (f upcItemDbParser) ParseBody(b []byte) (Product, error) {
-	doc, err := html.Parse(bytes.NewReader(b))
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			// Looking for <p class="detailtitle">....<b>$PRODUCT_NAME</b></p>
-			if c.Type == html.ElementNode {
-				switch c.Data {
-				case "p":
-					if len(c.Attr) == 1 {
-						classAttr := c.Attr[0]
-						if classAttr.Val == "detailtitle" && c.FirstChild != nil && c.FirstChild.NextSibling != nil && c.FirstChild.NextSibling.FirstChild != nil {
-							txt := c.FirstChild.NextSibling.FirstChild
-							if txt.Type == html.TextNode {
-								p.Name = txt.Data
-							}
-						}
-					}
-				case "img":
-					isProduct := false
-					for _, attr := range c.Attr {
-						if attr.Key == "class" && strings.Contains(attr.Val, "product") {
-							isProduct = true
-						}
-						if attr.Key == "src" && isProduct && len(p.ImageURL) == 0 {
-							p.ImageURL = attr.Val
-						}
-					}
-				default:
-					if p.ImageURL != "" && p.Name != "" {
-						return
-					}
-					fn(c)
-				}
-			}
-		}
-	}
-	fn(doc)
-	if p.Name == "" {
-		return p, errNotFound
-	}
-	return p, nil
-}
-
-type openFoodFactsParser struct{}
-
-type openFoodFactsJSON struct {
-	EAN     string `json:"code"`
-	Product struct {
-		Name     string `json:"product_name"`
-		ImageURL string `json:"image_front_url"`
-	}
-	Status int `json:"status"`
-}
-
-func (f openFoodFactsParser) ParseBody(body []byte) (Product, error) {
-	var v openFoodFactsJSON
-	p := Product{}
-	err := json.Unmarshal(body, &v)
-	if err != nil {
-		return p, err
-	}
-	if v.Status != 1 {
-		return p, errNotFound
-	}
-	p.Name = v.Product.Name
-	p.ImageURL = v.Product.ImageURL
-	p.WebsiteURL = fmt.Sprintf("http://fr.openfoodfacts.org/produit/%s/", v.EAN)
-	return p, nil
-}
-
-// amazonItemSearchResponse is the base xml response, only keep needed fields (maybe more will be added later) in a "flat" struct.
-type amazonItemSearchResponse struct {
-	TotalResults uint          `xml:"Items>TotalResults"`
-	Item         []amazonItem  `xml:"Items>Item"`
-	IsValid      string        `xml:"Items>Request>IsValid"`
-	RequestID    string        `xml:"OperationRequest>RequestId"`
-	Errors       []amazonError `xml:"Items>Request>Errors>Error"`
-}
-
-type amazonError struct {
-	Code    string
-	Message string
-}
-
-func (e *amazonError) Error() string {
-	return fmt.Sprintf("error from amazon: Code: %s, Message: %s", e.Code, e.Message)
-}
-
-type amazonItem struct {
-	Title          string `xml:"ItemAttributes>Title"`
-	ASIN           string
-	DetailPageURL  string
-	SmallImageURL  string `xml:"SmallImage>URL"`
-	MediumImageURL string `xml:"MediumImage>URL"`
-	LargeImageURL  string `xml:"LargeImage>URL"`
-}
-
-type amazonURL struct {
-	endPoint                           string
-	WebsiteName                        string
-	AccessKey, SecretKey, AssociateTag string
-}
-
-func newAmazonURLFetcher() (amazonURL, error) {
-	fetcher := amazonURL{}
-	var accessOk, secretOk, associateTagOk bool
-	fetcher.AccessKey, accessOk = os.LookupEnv("RECYCLEME_ACCESS_KEY")
-	fetcher.SecretKey, secretOk = os.LookupEnv("RECYCLEME_SECRET_KEY")
-	fetcher.AssociateTag, associateTagOk = os.LookupEnv("RECYCLEME_ASSOCIATE_TAG")
-	if accessOk && secretOk && associateTagOk {
-		fetcher.endPoint = "webservices.amazon.fr"
-		fetcher.WebsiteName = "Amazon.fr"
-		return fetcher, nil
-	}
-	return fetcher, errors.New("Missing either RECYCLEME_ACCESS_KEY, RECYCLEME_SECRET_KEY or RECYCLEME_ASSOCIATE_TAG in environment. AmazonFetcher will not be used")
+	return p, err
 }
 
-func (f amazonURL) IsURLValidForEAN(url, ean string) bool {
-	return f.endPoint+"/"+ean == url
+func (f FetchableURL) IsURLValidForEAN(url, ean string) bool {
+	code, err := FormatBarcode(ean, f.Barcode)
+	return err == nil && fullURL(f.URL, code) == url
 }
 
-func (f amazonURL) buildURL(ean string) (string, error) {
-	params := url.Values{}
-	params.Set("AWSAccessKeyId", f.AccessKey)
-	params.Set("AssociateTag", f.AssociateTag)
-	params.Set("Service", "AWSECommerceService")
-	params.Set("Operation", "ItemSearch")
-	params.Set("Timestamp", time.Now().Format(time.RFC3339))
-	params.Set("SearchIndex", "All")
-	params.Set("ResponseGroup", "Images,Small")
-	params.Set("Keywords", ean)
-	uri := "/onca/xml"
-	toSign := fmt.Sprintf("GET\n%s\n%s\n%s", f.endPoint, uri, strings.Replace(params.Encode(), "+", "%20", -1))
-
-	hasher := hmac.New(sha256.New, []byte(f.SecretKey))
-	_, err := hasher.Write([]byte(toSign))
-	if err != nil {
-		return "", err
-	}
-
-	signed := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
-	params.Set("Signature", signed)
-
-	url := fmt.Sprintf("http://%s%s?%s", f.endPoint, uri, params.Encode())
-	return url, nil
+func (f FetchableURL) Name() string {
+	return f.WebsiteName
 }
 
-func (f amazonURL) Fetch(ean string, db BlacklistDB) (Product, error) {
-	url, err := f.buildURL(ean)
-	endPoint := fmt.Sprintf("%s/%s", f.endPoint, ean)
-	if err != nil {
-		return Product{}, newProductError(ean, endPoint, err)
+func (f FetchableURL) AcceptsCategory(c BarcodeCategory) bool {
+	if len(f.Categories) == 0 {
+		return true
 	}
-	p, err := withCheckInBlacklist(db, ean, endPoint, func() (Product, error) {
-		body, err := fetchURL(url)
-		if err != nil {
-			return Product{}, err
-		}
-
-		var response amazonItemSearchResponse
-		err = xml.Unmarshal(body, &response)
-		if err != nil {
-			return Product{}, err
-		}
-		if response.IsValid == "False" {
-			if len(response.Errors) == 0 {
-				return Product{}, fmt.Errorf("invalid response for RequestId" + response.RequestID)
-			}
-			var errors []string
-			for _, e := range response.Errors {
-				errors = append(errors, e.Error())
-			}
-			return Product{}, fmt.Errorf(strings.Join(errors, "; "))
-		}
-
-		if response.TotalResults == 0 {
-			return Product{}, errNotFound
-		}
-		if response.TotalResults > 1 {
-			return Product{}, errTooManyProducts
+	for _, category := range f.Categories {
+		if category == c {
+			return true
 		}
-
-		firstItem := response.Item[0]
-		return Product{EAN: ean, URL: endPoint, Name: firstItem.Title, ImageURL: firstItem.LargeImageURL, WebsiteURL: firstItem.DetailPageURL, WebsiteName: f.WebsiteName}, nil
-	})
-	if err != nil {
-		pErr := err.(*productError)
-		pErr.URL = endPoint
 	}
-	return p, err
+	return false
 }
 
 type mgoLocalProductDB struct {
@@ -468,8 +324,12 @@ func NewMgoLocalProductDB(s *mgo.Session, colPrefix string) *mgoLocalProductDB {
 	return &mgoLocalProductDB{mgoDB: mgoDB{session: s}, colName: colPrefix + "local_products"}
 }
 
-func (db mgoLocalProductDB) Fetch(ean string, blacklist BlacklistDB) (Product, error) {
+func (db mgoLocalProductDB) Fetch(ctx context.Context, ean string, blacklist BlacklistDB) (Product, error) {
 	var foundProduct Product
+	// mgo does not support cancellation, at least do not query if it is not needed anymore
+	if err := ctx.Err(); err != nil {
+		return foundProduct, newProductError(ean, "/local/", err)
+	}
 	err := withMgoSession(db.session, func(s *mgo.Session) error {
 		var products []Product
 		if err := s.DB("").C(db.colName).Find(bson.M{"ean": ean}).All(&products); err != nil {
@@ -496,6 +356,10 @@ func (db mgoLocalProductDB) Fetch(ean string, blacklist BlacklistDB) (Product, e
 	return foundProduct, err
 }
 
+func (db mgoLocalProductDB) Name() string {
+	return LocalFetcherName
+}
+
 func (db mgoLocalProductDB) IsURLValidForEAN(myURL, ean string) bool {
 	if !strings.HasPrefix(myURL, "/local/") {
 		return false
@@ -520,244 +384,149 @@ func (db mgoLocalProductDB) IsURLValidForEAN(myURL, ean string) bool {
 	return isValid
 }
 
-type starrymartParser struct{}
+type DefaultFetcher struct {
+	fetchers []Fetcher
+	// Priorities of fetchers by name, the higher the better. Missing fetchers have a priority of 0.
+	Priorities map[string]int
+	// GraceWindow is how long to wait for other results once a first Product is found, to return the best one.
+	// If 0, the first Product found is returned.
+	GraceWindow time.Duration
+	// Deadline after which the first Product found is returned, without waiting for the GraceWindow.
+	// If 0, there is no deadline.
+	Deadline time.Duration
+	// Merge fields (Name, ImageURL, WebsiteURL) of all Products found instead of returning only the best one.
+	// Missing fields of the best Product are taken from the next best ones, and their sources are recorded.
+	Merge bool
+	// flights coalesces concurrent lookups of the same EAN, if nil every lookup is run
+	flights *flightGroup
+}
+
+// DefaultPriorities favors authoritative sources: our own local_products, then OpenFoodFacts
+var DefaultPriorities = map[string]int{
+	LocalFetcherName:    10,
+	"OpenFoodFacts":     5,
+	"OpenBeautyFacts":   5,
+	"OpenProductsFacts": 5,
+	"OpenPetFoodFacts":  5,
+}
+
+const (
+	DefaultGraceWindow = 500 * time.Millisecond
+	DefaultDeadline    = 5 * time.Second
+)
 
-func (f starrymartParser) ParseBody(b []byte) (Product, error) {
-	doc, err := html.Parse(bytes.NewReader(b))
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				if c.Data == "div" {
-					if len(c.Attr) == 1 && c.Attr[0].Key == "class" && c.Attr[0].Val == "item-img-info" {
-						if c.FirstChild != nil && c.FirstChild.NextSibling != nil {
-							a := c.FirstChild.NextSibling
-							for i := range a.Attr {
-								params := a.Attr[i]
-								switch params.Key {
-								case "href":
-									p.WebsiteURL = params.Val
-								case "title":
-									p.Name = params.Val
-								}
-
-							}
-							if a.FirstChild != nil && a.FirstChild.NextSibling != nil && a.FirstChild.NextSibling.FirstChild != nil && a.FirstChild.NextSibling.FirstChild.NextSibling != nil {
-								img := a.FirstChild.NextSibling.FirstChild.NextSibling
-								for i := range img.Attr {
-									params := img.Attr[i]
-									switch params.Key {
-									case "src":
-										p.ImageURL = params.Val
-
-									}
-								}
-							}
-						}
-						return
-					}
-				}
-				fn(c)
-			}
-		}
-	}
-	fn(doc)
-	if p.Name == "" {
-		return p, errNotFound
+// score ranks a Product found by a fetcher: priority first, then completeness of the data
+func (f DefaultFetcher) score(fetcherName string, p Product) int {
+	score := f.Priorities[fetcherName] * 8
+	if p.Name != "" {
+		score += 4
 	}
-	return p, nil
-}
-
-type misterPharmaWebParser struct {
-	baseURL string
-}
-
-func (f misterPharmaWebParser) ParseBody(b []byte) (Product, error) {
-	charsetReader := charmap.ISO8859_1.NewDecoder().Reader(bytes.NewReader(b))
-	doc, err := html.Parse(charsetReader) // charset is ISO-8859-1
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				if c.Data == "img" {
-					isProduct := false
-					for _, attr := range c.Attr {
-						if attr.Key == "class" && attr.Val == "lazy" {
-							isProduct = true
-						} else if !isProduct {
-							break
-						}
-						if attr.Key == "data-src" && isProduct && len(p.ImageURL) == 0 {
-							p.ImageURL = f.baseURL + attr.Val
-						}
-						if attr.Key == "alt" && isProduct && len(p.Name) == 0 {
-							p.Name = attr.Val
-						}
-					}
-					if p.Name != "" && isProduct {
-						if len(c.Parent.Attr) == 1 && c.Parent.Attr[0].Key == "href" {
-							p.WebsiteURL = c.Parent.Attr[0].Val
-						}
-						return
-					}
-				}
-				fn(c)
-			}
-		}
+	if p.ImageURL != "" {
+		score += 2
 	}
-	fn(doc)
-	if p.Name == "" {
-		return p, errNotFound
+	if p.WebsiteURL != "" {
+		score++
 	}
-	return p, nil
+	return score
 }
 
-type medisparParser struct {
-	baseURL string
+type rankedProduct struct {
+	p     Product
+	score int
 }
 
-func (f medisparParser) ParseBody(b []byte) (Product, error) {
-	charsetReader := charmap.ISO8859_1.NewDecoder().Reader(bytes.NewReader(b))
-	doc, err := html.Parse(charsetReader) // charset is ISO-8859-1
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				if c.Data == "a" {
-					isProduct := false
-					name := ""
-					url := ""
-					for _, attr := range c.Attr {
-						if attr.Key == "class" && attr.Val == "drug_title" {
-							isProduct = true
-						}
-						if attr.Key == "title" {
-							name = strings.Replace(attr.Val, "  ", " ", -1)
-							name = strings.Replace(name, "\n", "", -1)
-						}
-						if attr.Key == "href" {
-							url = attr.Val
-						}
-					}
-					if isProduct && name != "" && url != "" {
-						p.Name = name
-						if !strings.Contains(url, "http") {
-							url = f.baseURL + url
-						}
-						p.WebsiteURL = url
-						return
-					}
-				}
-				fn(c)
-			}
+// mergeProducts merges Products from the best ranked to the worst one, only empty fields are set.
+// The best ranked Product is the base of the result (EAN, URL, WebsiteName).
+// The URLs of the Products which supplied a field are recorded in the Sources.
+func mergeProducts(products []rankedProduct) Product {
+	sort.SliceStable(products, func(i, j int) bool { return products[i].score > products[j].score })
+	p := products[0].p
+	p.Sources = &ProductSources{}
+	for _, rp := range products {
+		if p.Sources.Name == "" && rp.p.Name != "" {
+			p.Name = rp.p.Name
+			p.Sources.Name = rp.p.WebsiteName
 		}
-	}
-	fn(doc)
-	if p.Name == "" {
-		return p, errNotFound
-	}
-	return p, nil
-}
-
-type picardParser struct {
-	baseURL string
-}
-
-func (f picardParser) ParseBody(b []byte) (Product, error) {
-	doc, err := html.Parse(bytes.NewReader(b))
-	p := Product{}
-	if err != nil {
-		return p, err
-	}
-	var fn func(*html.Node)
-	fn = func(n *html.Node) {
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if c.Type == html.ElementNode {
-				if c.Data == "a" {
-					product := false
-					for _, v := range c.Attr {
-						if v.Key == "class" && v.Val == "productGTMSearchImg" {
-							product = true
-						}
-						if product {
-							if v.Key == "href" {
-								p.WebsiteURL = f.baseURL + v.Val
-							} else if v.Key == "title" {
-								p.Name = v.Val
-							}
-						}
-					}
-				} else if c.Data == "img" && p.Name != "" {
-					url := ""
-					for _, v := range c.Attr {
-						if v.Key == "src" {
-							url = v.Val
-						}
-						if v.Key == "alt" && v.Val == p.Name {
-							p.ImageURL = url
-							return
-						}
-					}
-				}
-				if p.Name == "" || p.ImageURL == "" {
-					fn(c)
-				}
-			}
+		if p.Sources.ImageURL == "" && rp.p.ImageURL != "" {
+			p.ImageURL = rp.p.ImageURL
+			p.Sources.ImageURL = rp.p.WebsiteName
+		}
+		if p.Sources.WebsiteURL == "" && rp.p.WebsiteURL != "" {
+			p.WebsiteURL = rp.p.WebsiteURL
+			p.Sources.WebsiteURL = rp.p.WebsiteName
+		}
+		if p.Sources.Packaging == "" && rp.p.Packaging != nil {
+			p.Packaging = rp.p.Packaging
+			p.Sources.Packaging = rp.p.WebsiteName
 		}
 	}
-	fn(doc)
-	if p.Name == "" {
-		return p, errNotFound
+	for _, rp := range products {
+		name := rp.p.WebsiteName
+		supplied := name == p.Sources.Name || name == p.Sources.ImageURL || name == p.Sources.WebsiteURL || name == p.Sources.Packaging
+		if supplied && rp.p.URL != "" {
+			p.Sources.URLs = append(p.Sources.URLs, rp.p.URL)
+		}
 	}
-	return p, nil
-}
-
-type DefaultFetcher struct {
-	fetchers []Fetcher
+	return p
 }
 
 // NewDefaultFetcher fetches data from a list of default fetchers already implemented.
 // Currently supported websites:
 // - upcitemdb
-// - openfoodfacts
+// - openfoodfacts, openbeautyfacts, openproductsfacts and openpetfoodfacts
 // - iGalerie (some random IP on internet)
 // - amazon (if credentials are provided)
 // - StarryMart
 // - MisterPharmaWeb
 // - Meddispar
+// - Picard
+// - websites described in the scraper definitions of the RECYCLEME_SCRAPERS_DIR directory (see ScraperDefinition),
+// a definition with the name of a website above replaces it
 // - more fetchers are provided as arguments (local database, ...)
+// Each fetcher is skipped while its source is failing (see Health).
 // TODO: should return a warning, or info, not an error.
 func NewDefaultFetcher(otherFetchers ...Fetcher) (DefaultFetcher, error) {
 	fetchers := []Fetcher{
 		UpcItemDbFetcher,
 		OpenFoodFactsFetcher,
+		OpenBeautyFactsFetcher,
+		OpenProductsFactsFetcher,
+		OpenPetFoodFactsFetcher,
+		IsbnSearchFetcher,
 		IGalerieFetcher,
 		StarrymartFetcher,
 		MisterPharmaWebFetcher,
 		MedisparFetcher,
 		PicardFetcher,
 	}
+	var scrapersErr error
+	if dir, ok := os.LookupEnv("RECYCLEME_SCRAPERS_DIR"); ok {
+		defs, err := LoadScraperDefinitions(dir)
+		if err == nil {
+			fetchers, err = withScrapers(fetchers, defs)
+		}
+		scrapersErr = err
+	}
 	for _, f := range otherFetchers {
 		fetchers = append(fetchers, f)
 	}
+	// each source has its own circuit breaker, to skip it while it is down
+	for i, f := range fetchers {
+		fetchers[i] = newBreakerFetcher(f)
+	}
+	priorities := make(map[string]int, len(DefaultPriorities))
+	for name, priority := range DefaultPriorities {
+		priorities[name] = priority
+	}
+	f := DefaultFetcher{fetchers: fetchers, Priorities: priorities, GraceWindow: DefaultGraceWindow, Deadline: DefaultDeadline, flights: newFlightGroup()}
 	amazonFetcher, err := newAmazonURLFetcher()
-	if err != nil {
-		return DefaultFetcher{fetchers: fetchers}, err
+	if err == nil {
+		f.fetchers = append(f.fetchers, newBreakerFetcher(amazonFetcher))
+	}
+	if scrapersErr != nil {
+		return f, scrapersErr
 	}
-	fetchers = append(fetchers, amazonFetcher)
-	return DefaultFetcher{fetchers: fetchers}, nil
+	return f, err
 }
 
 func (f DefaultFetcher) IsURLValidForEAN(url, ean string) bool {
@@ -771,50 +540,114 @@ func (f DefaultFetcher) IsURLValidForEAN(url, ean string) bool {
 
 // Fetch a Product data bases on its EAN with default Fetchers
 // All Default Fetchers are executed in goroutines
-// Return the Product if it is found on one site (the fastest).
-func (f DefaultFetcher) Fetch(ean string, db BlacklistDB) (Product, error) {
-	if !eancheck.Valid(ean) {
-		return Product{}, errInvalidEAN
-
+// Once a first Product is found, other results are gathered during the GraceWindow and the best scored one is returned,
+// or all of them are merged if Merge is set.
+// After the Deadline, the first Product found is returned. Other fetchers are then cancelled.
+// ean may be any barcode accepted by NormalizeBarcode, products are looked up by its canonical GTIN.
+// Concurrent lookups of the same EAN share the same fetchers and result.
+func (f DefaultFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	ean, err := NormalizeBarcode(ean)
+	if err != nil {
+		return Product{}, err
+	}
+	if f.flights == nil {
+		return f.fetch(ctx, ean, db)
 	}
+	return f.flights.do(ctx, ean, func(ctx context.Context) (Product, error) {
+		return f.fetch(ctx, ean, db)
+	})
+}
+
+func (f DefaultFetcher) fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
 	type prodErr struct {
-		p   Product
-		err error
+		p    Product
+		err  error
+		name string
 	}
 
-	c := make(chan prodErr)
-	q := make(chan struct{})
+	// sources which cannot hold this kind of code (e.g. food databases for books) are not queried
+	category := CategoryProduct
+	if info, err := DecodeBarcode(ean); err == nil {
+		category = info.Category
+	}
+	errors := make([]error, 0, len(f.fetchers))
+	var fetchers []Fetcher
 	for _, f := range f.fetchers {
+		if acceptsCategory(f, category) {
+			fetchers = append(fetchers, f)
+		} else {
+			errors = append(errors, newProductError(ean, fetcherName(f), errUnsupportedBarcode))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := make(chan prodErr)
+	for _, f := range fetchers {
 		go func(f Fetcher) {
-			product, err := f.Fetch(ean, db)
+			product, err := f.Fetch(ctx, ean, db)
 			select {
-			case <-q:
+			case <-ctx.Done():
 				return
-			case c <- prodErr{product, err}:
+			case c <- prodErr{product, err, fetcherName(f)}:
 				return
 			}
 		}(f)
 	}
 
-	defer close(q)
-	errors := make([]error, 0, len(f.fetchers))
-	i := 0
-	for pe := range c {
-		i++
-		if pe.err != nil {
-			errors = append(errors, pe.err)
-			if i == len(f.fetchers) {
-				break
+	var grace, deadline <-chan time.Time
+	if f.Deadline > 0 {
+		t := time.NewTimer(f.Deadline)
+		defer t.Stop()
+		deadline = t.C
+	}
+	firstWins := f.GraceWindow <= 0
+	var found []rankedProduct
+	result := func() Product {
+		if f.Merge {
+			return mergeProducts(found)
+		}
+		best := found[0]
+		for _, rp := range found[1:] {
+			if rp.score > best.score {
+				best = rp
+			}
+		}
+		return best.p
+	}
+
+	for i := 0; i < len(fetchers); {
+		select {
+		case <-ctx.Done():
+			return Product{}, ctx.Err()
+		case <-grace:
+			return result(), nil
+		case <-deadline:
+			if len(found) > 0 {
+				return result(), nil
+			}
+			firstWins = true
+			deadline = nil
+		case pe := <-c:
+			i++
+			if pe.err != nil {
+				errors = append(errors, pe.err)
+				continue
+			}
+			found = append(found, rankedProduct{p: pe.p, score: f.score(pe.name, pe.p)})
+			if firstWins {
+				return result(), nil
+			}
+			if grace == nil {
+				t := time.NewTimer(f.GraceWindow)
+				defer t.Stop()
+				grace = t.C
 			}
-		} else {
-			return pe.p, nil
 		}
 	}
-
-	errStr := make([]string, 1, len(errors)+1)
-	errStr[0] = ""
-	for _, err := range errors {
-		errStr = append(errStr, err.Error())
+	if len(found) > 0 {
+		return result(), nil
 	}
-	return Product{}, fmt.Errorf("no product found because of the following errors:%v", strings.Join(errStr, "\n - "))
+
+	return Product{}, fetchErrors(errors)
 }
@@ -1,7 +1,11 @@
 package recycleme
 
 import (
+	"context"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBlacklist(t *testing.T) {
@@ -14,7 +18,7 @@ func TestBlacklist(t *testing.T) {
 	} else if !ok {
 		t.Fatalf("%v not in blacklist", url)
 	}
-	_, err := UpcItemDbFetcher.Fetch("3057640136573", blacklistDB)
+	_, err := UpcItemDbFetcher.Fetch(context.Background(), "3057640136573", blacklistDB)
 	if err == nil {
 		t.Fatalf("%v not blacklisted", url)
 	}
@@ -23,34 +27,9 @@ func TestBlacklist(t *testing.T) {
 	}
 }
 
-func TestAmazonFetcher(t *testing.T) {
-	amazonFetcher, err := newAmazonURLFetcher()
-
-	if amazonFetcher.SecretKey == "" || amazonFetcher.AccessKey == "" || amazonFetcher.AssociateTag == "" {
-		t.Log("Missing either AccessKey, SecretKey or AssociateTag. AmazonFetcher will not be tested")
-		return
-	}
-	_, err = amazonFetcher.Fetch("4006381333634", blacklistDB)
-	if err != nil {
-		if err.(*productError).err != errTooManyProducts {
-			t.Fatal(err)
-		}
-	}
-	p, err := amazonFetcher.Fetch("5021991938818", blacklistDB)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if p.Name != "Clipper Thé Vert Biologique 20 infusettes" ||
-		p.EAN != "5021991938818" ||
-		p.URL != "webservices.amazon.fr/5021991938818" ||
-		p.ImageURL != "http://ecx.images-amazon.com/images/I/517qE9owUDL.jpg" ||
-		p.WebsiteURL != "http://www.amazon.fr/Clipper-Th%C3%A9-Vert-Biologique-infusettes/dp/B011C4L3S0%3FSubscriptionId%3DAKIAIOSACIYSSJVD3IQA%26tag%3Dhowtorecme-21%26linkCode%3Dxm2%26camp%3D2025%26creative%3D165953%26creativeASIN%3DB011C4L3S0" {
-		t.Errorf("Some attributes are invalid for: %v", p)
-	}
-}
-
 func TestDefaultFetchers(t *testing.T) {
-	p, err := UpcItemDbFetcher.Fetch("5029053038896", blacklistDB)
+	defer replayFixtures(t)()
+	p, err := UpcItemDbFetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "Kleenex tissues in a Christmas House box" ||
@@ -61,7 +40,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = UpcItemDbFetcher.Fetch("4006381333634", blacklistDB)
+	p, err = UpcItemDbFetcher.Fetch(context.Background(), "4006381333634", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "Stabilo Boss Original Highlighter Blue" ||
@@ -72,7 +51,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = OpenFoodFactsFetcher.Fetch("7613034383808", blacklistDB)
+	p, err = OpenFoodFactsFetcher.Fetch(context.Background(), "7613034383808", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "Four à Pierre Royale" || p.EAN != "7613034383808" ||
@@ -82,7 +61,37 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = IGalerieFetcher.Fetch("8714789941011", blacklistDB)
+	for _, expected := range []Product{
+		{EAN: "3600523183227", Name: "Ultra Doux Shampooing Camomille",
+			URL:        "http://fr.openbeautyfacts.org/api/v0/produit/3600523183227.json",
+			WebsiteURL: "http://fr.openbeautyfacts.org/produit/3600523183227/", WebsiteName: "OpenBeautyFacts",
+			ImageURL:  "http://static.openbeautyfacts.org/images/products/360/052/318/3227/front_fr.4.400.jpg",
+			Packaging: &PackagingData{Text: "Flacon,Plastique", Tags: []string{"flacon", "plastique"}}},
+		{EAN: "3178041328203", Name: "Éponges grattantes x4",
+			URL:        "http://fr.openproductsfacts.org/api/v0/produit/3178041328203.json",
+			WebsiteURL: "http://fr.openproductsfacts.org/produit/3178041328203/", WebsiteName: "OpenProductsFacts",
+			ImageURL:  "http://static.openproductsfacts.org/images/products/317/804/132/8203/front_fr.3.400.jpg",
+			Packaging: &PackagingData{Text: "Sachet,Plastique", Tags: []string{"sachet", "plastique"}}},
+		{EAN: "7613035256224", Name: "Friskies Junior au poulet",
+			URL:        "http://fr.openpetfoodfacts.org/api/v0/produit/7613035256224.json",
+			WebsiteURL: "http://fr.openpetfoodfacts.org/produit/7613035256224/", WebsiteName: "OpenPetFoodFacts",
+			ImageURL:  "http://static.openpetfoodfacts.org/images/products/761/303/525/6224/front_fr.5.400.jpg",
+			Packaging: &PackagingData{Text: "Carton", Tags: []string{"carton"}}},
+		{EAN: "9780134190440", Name: "The Go Programming Language (Addison-Wesley Professional Computing Series)",
+			URL: "https://isbnsearch.org/isbn/0134190440", WebsiteURL: "https://isbnsearch.org/isbn/0134190440", WebsiteName: "ISBNSearch",
+			ImageURL:  "https://images-na.ssl-images-amazon.com/images/I/41aSIuXGwJL._SL160_.jpg",
+			Packaging: &PackagingData{Tags: []string{"en:paper"}}},
+	} {
+		fetcher := map[string]Fetcher{"OpenBeautyFacts": OpenBeautyFactsFetcher, "OpenProductsFacts": OpenProductsFactsFetcher,
+			"OpenPetFoodFacts": OpenPetFoodFactsFetcher, "ISBNSearch": IsbnSearchFetcher}[expected.WebsiteName]
+		if p, err := fetcher.Fetch(context.Background(), expected.EAN, blacklistDB); err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(p, expected) {
+			t.Errorf("expected %v, got %v", expected, p)
+		}
+	}
+
+	p, err = IGalerieFetcher.Fetch(context.Background(), "8714789941011", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "" || p.EAN != "8714789941011" ||
@@ -92,7 +101,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = localProductDB.Fetch("ean_test", blacklistDB)
+	p, err = localProductDB.Fetch(context.Background(), "ean_test", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "name_test" || p.EAN != "ean_test" ||
@@ -102,7 +111,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = StarrymartFetcher.Fetch("4897878100026", blacklistDB)
+	p, err = StarrymartFetcher.Fetch(context.Background(), "4897878100026", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "Nissin Cup Noodles Beef Flavour 75g" || p.EAN != "4897878100026" ||
@@ -112,7 +121,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = MisterPharmaWebFetcher.Fetch("3400937688369", blacklistDB)
+	p, err = MisterPharmaWebFetcher.Fetch(context.Background(), "3400937688369", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "HUMEX ALLERGIE CETIRIZINE 10 mg, comprimé pelliculé sécable" || p.EAN != "3400937688369" ||
@@ -122,7 +131,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = MedisparFetcher.Fetch("3400936864986", blacklistDB)
+	p, err = MedisparFetcher.Fetch(context.Background(), "3400936864986", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "NUROFEN 400mg CPR ENR B/12" || p.EAN != "3400936864986" ||
@@ -132,7 +141,7 @@ func TestDefaultFetchers(t *testing.T) {
 		t.Errorf("Some attributes are invalid for: %v", p)
 	}
 
-	p, err = PicardFetcher.Fetch("3270160891382", blacklistDB)
+	p, err = PicardFetcher.Fetch(context.Background(), "3270160891382", blacklistDB)
 	if err != nil {
 		t.Error(err)
 	} else if p.Name != "2 quiches lorraines" || p.EAN != "3270160891382" ||
@@ -153,20 +162,197 @@ func TestLocalProductDB(t *testing.T) {
 }
 
 func TestDefaultFetcher(t *testing.T) {
+	defer replayFixtures(t)()
 	fetcher, _ := NewDefaultFetcher()
-	_, err := fetcher.Fetch("5029053038896", blacklistDB)
+	_, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = fetcher.Fetch("7613034383808", blacklistDB)
+	_, err = fetcher.Fetch(context.Background(), "7613034383808", blacklistDB)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Fake EAN, should return an error
-	_, err = fetcher.Fetch("4012345123456", blacklistDB)
+	_, err = fetcher.Fetch(context.Background(), "4012345123456", blacklistDB)
 	if err == nil {
 		t.Fatal("Error should not be nil")
 	}
 }
+
+// blockingFetcher blocks until its context is cancelled, and reports it
+type blockingFetcher struct {
+	cancelled chan struct{}
+}
+
+func (f blockingFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	<-ctx.Done()
+	close(f.cancelled)
+	return Product{}, newProductError(ean, "blocking", ctx.Err())
+}
+
+func (f blockingFetcher) IsURLValidForEAN(url, ean string) bool {
+	return false
+}
+
+func TestDefaultFetcherCancel(t *testing.T) {
+	slow := blockingFetcher{cancelled: make(chan struct{})}
+	fast := testFetcher{URL: "http://www.example.com/%s/", WebsiteName: "Example.com"}
+	fetcher := DefaultFetcher{fetchers: []Fetcher{slow, fast}}
+	p, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.WebsiteName != fast.WebsiteName {
+		t.Errorf("expected product from %v, got %v", fast.WebsiteName, p)
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(time.Second):
+		t.Error("slow fetcher was not cancelled")
+	}
+
+	slow = blockingFetcher{cancelled: make(chan struct{})}
+	fetcher = DefaultFetcher{fetchers: []Fetcher{slow}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fetcher.Fetch(ctx, "5029053038896", blacklistDB); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(time.Second):
+		t.Error("fetcher was not cancelled")
+	}
+}
+
+// delayedFetcher returns its Product or error after some delay
+type delayedFetcher struct {
+	name  string
+	delay time.Duration
+	p     Product
+	err   error
+}
+
+func (f delayedFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	select {
+	case <-ctx.Done():
+		return Product{}, newProductError(ean, f.name, ctx.Err())
+	case <-time.After(f.delay):
+	}
+	if f.err != nil {
+		return Product{}, newProductError(ean, f.name, f.err)
+	}
+	p := f.p
+	p.EAN = ean
+	p.WebsiteName = f.name
+	return p, nil
+}
+
+func (f delayedFetcher) IsURLValidForEAN(url, ean string) bool {
+	return false
+}
+
+func (f delayedFetcher) Name() string {
+	return f.name
+}
+
+func TestDefaultFetcherRanking(t *testing.T) {
+	fastPoor := delayedFetcher{name: "fast", p: Product{Name: "poor name"}}
+	slowComplete := delayedFetcher{name: "complete", delay: 20 * time.Millisecond, p: Product{Name: "name", ImageURL: "http://www.example.com/image.jpg"}}
+	slowAuthoritative := delayedFetcher{name: LocalFetcherName, delay: 30 * time.Millisecond, p: Product{Name: "local name"}}
+	tooSlow := delayedFetcher{name: "too slow", delay: time.Second, p: Product{Name: "too slow"}}
+	failing := delayedFetcher{name: "failing", err: errNotFound}
+
+	fetcher := DefaultFetcher{
+		fetchers:    []Fetcher{fastPoor, slowComplete, failing, tooSlow},
+		GraceWindow: 200 * time.Millisecond,
+	}
+	p, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.WebsiteName != slowComplete.name {
+		t.Errorf("expected most complete product from %v, got %v", slowComplete.name, p)
+	}
+
+	fetcher.fetchers = append(fetcher.fetchers, slowAuthoritative)
+	fetcher.Priorities = map[string]int{LocalFetcherName: 10}
+	p, err = fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.WebsiteName != LocalFetcherName {
+		t.Errorf("expected product with highest priority from %v, got %v", LocalFetcherName, p)
+	}
+
+	// all fetchers answered, do not wait for the grace window
+	fetcher = DefaultFetcher{
+		fetchers:    []Fetcher{fastPoor, failing},
+		GraceWindow: time.Minute,
+	}
+	start := time.Now()
+	p, err = fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second || p.WebsiteName != fastPoor.name {
+		t.Errorf("expected product from %v without waiting, got %v after %v", fastPoor.name, p, time.Since(start))
+	}
+
+	// after the deadline, the first product found is returned
+	fetcher = DefaultFetcher{
+		fetchers:    []Fetcher{delayedFetcher{name: "late", delay: 50 * time.Millisecond, p: Product{Name: "late"}}, tooSlow},
+		GraceWindow: time.Minute,
+		Deadline:    10 * time.Millisecond,
+	}
+	start = time.Now()
+	p, err = fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 500*time.Millisecond || p.WebsiteName != "late" {
+		t.Errorf("expected first product after deadline, got %v after %v", p, time.Since(start))
+	}
+}
+
+func TestDefaultFetcherMerge(t *testing.T) {
+	named := delayedFetcher{name: "named", p: Product{Name: "name", URL: "http://www.example.com/named.json", WebsiteURL: "http://www.example.com/named"}}
+	withImage := delayedFetcher{name: "image", delay: 10 * time.Millisecond, p: Product{ImageURL: "http://www.example.com/image.jpg", URL: "http://www.example.com/image.json", WebsiteURL: "http://www.example.com/image"}}
+	local := delayedFetcher{name: LocalFetcherName, delay: 20 * time.Millisecond, p: Product{Name: "local name"}}
+	fetcher := DefaultFetcher{
+		fetchers:    []Fetcher{named, withImage, local},
+		Priorities:  map[string]int{LocalFetcherName: 10},
+		GraceWindow: time.Second,
+		Merge:       true,
+	}
+	p, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "local name" || p.ImageURL != withImage.p.ImageURL || p.WebsiteURL != named.p.WebsiteURL || p.WebsiteName != LocalFetcherName {
+		t.Errorf("Some attributes are invalid for: %v", p)
+	}
+	expected := ProductSources{Name: LocalFetcherName, ImageURL: withImage.name, WebsiteURL: named.name, URLs: []string{named.p.URL, withImage.p.URL}}
+	if p.Sources == nil || !reflect.DeepEqual(*p.Sources, expected) {
+		t.Errorf("expected sources %v, got %v", expected, p.Sources)
+	}
+
+	out, err := p.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"sources":{"name":"local","image_url":"image","website_url":"named","urls":["http://www.example.com/named.json","http://www.example.com/image.json"]}`) {
+		t.Errorf("sources not in json: %s", out)
+	}
+
+	fetcher.Merge = false
+	p, err = fetcher.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Sources != nil || p.ImageURL != "" {
+		t.Errorf("product should not be merged: %v", p)
+	}
+}
@@ -27,6 +27,23 @@ BarcodeReader.SetImageErrorCallback(function() {
     $("#help").text("cannot read image");
 });
 
+// errorMessage returns the message of a json error body, or the raw response
+function errorMessage(xhr) {
+    try {
+        return JSON.parse(xhr.responseText).error;
+    } catch (e) {
+        return xhr.responseText;
+    }
+}
+
+// collectionTypes describes bins which are not in buildings
+var collectionTypes = {
+    drop_off: "Point d'apport volontaire",
+    recycling_centre: "Déchèterie",
+    pharmacy: "À rapporter en pharmacie",
+    take_back: "À rapporter en magasin"
+};
+
 var App = {
     init: function(job) {
         this.attachListeners();
@@ -58,13 +75,26 @@ var App = {
             var barcodeVal = barcode.val();
             return self.submit(barcodeVal);
         });
+
+        $("#confirm_suggested").click(function() {
+            var product = self.product;
+            if (product == null || !product.suggested_materials) {
+                return;
+            }
+            $.post("/package/add", {materials: JSON.stringify(product.suggested_materials), ean: product.ean}, function() {
+                self.submit(product.ean);
+            });
+        });
     },
     detachListeners: function() {
         $("#recycle_form").off("submit");
+        $("#confirm_suggested").off("click");
     },
 
     reset: function() {
         $("#no_data").hide();
+        $("#suggested").hide();
+        $("#suggested_materials").empty();
         $("#product").hide();
         $(".name").empty();
         $(".ean").empty();
@@ -74,6 +104,45 @@ var App = {
         $("#source").empty();
     },
 
+    // renderBin returns the pictogram, name, materials and instructions of a bin, with the colour of its lid.
+    // The preparation steps and warnings of materials are taken from plans, by material id.
+    renderBin: function(bin, plans) {
+        var div = $('<div class="text-center bin"></div>');
+        if (bin.color) {
+            div.css("border-top", "8px solid " + bin.color);
+        }
+        if (bin.icon_url) {
+            div.append($('<img class="bin-icon">').attr("src", bin.icon_url).attr("alt", bin.name));
+        }
+        div.append($("<h3></h3>").text(bin.name));
+        var materials = $("<div></div>");
+        for (var i = 0; i < bin.materials.length; i++) {
+            var material = bin.materials[i];
+            materials.append($("<div></div>").text(material.name));
+            var plan = plans[material.id] || {};
+            var steps = plan.steps || [];
+            if (steps.length > 0) {
+                var list = $('<ol class="text-left"></ol>');
+                for (var j = 0; j < steps.length; j++) {
+                    list.append($("<li></li>").text(steps[j]));
+                }
+                materials.append(list);
+            }
+            var warnings = plan.warnings || [];
+            for (var j = 0; j < warnings.length; j++) {
+                materials.append($('<p class="text-danger"></p>').text(warnings[j]));
+            }
+        }
+        div.append(materials);
+        if (bin.instructions) {
+            div.append($('<p class="help-block"></p>').text(bin.instructions));
+        }
+        if (bin.collection_type && bin.collection_type != "kerbside") {
+            div.append($('<p class="help-block"></p>').text(collectionTypes[bin.collection_type] || bin.collection_type));
+        }
+        return div;
+    },
+
     startLoading: function() {
         this.isLoading = true;
         $("#loading").fadeTo("fast", 1.);
@@ -119,41 +188,31 @@ var App = {
                 $("#product").show();
 
                 if (jQuery.isEmptyObject(throwAway)) {
+                    var suggested = self.product.suggested_materials || [];
+                    if (suggested.length > 0) {
+                        $("#suggested_materials").text(suggested.map(function(m) { return m.name; }).join(", "));
+                        $("#suggested").show();
+                    }
                     $("#no_data").show();
                     self.stopLoading();
                 } else {
-                    var binCount = 0;
-                    var bins = {};
-                    for (var k in throwAway) {
-                        binCount++;
-                        var bin = throwAway[k];
-                        if (bin in bins) {
-                            bins[bin].push(k);
-                        } else {
-                            bins[bin] = [k];
-                        }
-                    }
-
                     var binDiv = $("#bins");
                     binDiv.empty();
-                    var binCls = "col-sm-" + parseInt(12 / binCount);
-
-                    var binId = 0;
-                    for (var k in bins) {
-                        binDiv.append('<div class="text-center"><h3>' + k + '</h3><div id="bin-' + parseInt(binId) + '"></div></div>');
-                        var bin = $("#bin-" + parseInt(binId));
-                        var materials = bins[k];
-                        for (var i = 0; i < materials.length; i++) {
-                            bin.append(materials[i] + "<br>");
-                        }
-                        binId++;
+                    var bins = data.bins || [];
+                    var plans = {};
+                    var plan = data.plan || [];
+                    for (var i = 0; i < plan.length; i++) {
+                        plans[plan[i].material.id] = plan[i];
+                    }
+                    for (var i = 0; i < bins.length; i++) {
+                        binDiv.append(self.renderBin(bins[i], plans));
                     }
                     $("#throwaway").show();
                     self.stopLoading();
                 }
             }).fail(function(xhr) {
                 recycle.addClass("has-error");
-                $("#help").html(xhr.responseText.replace(/\n/g, "<br>"));
+                $("#help").text(errorMessage(xhr));
                 self.stopLoading();
             });
         }
@@ -200,7 +259,7 @@ var Suggester = {
         });
 
         $(".suggest_button").click(function() {
-            var url = "/materials/";
+            var url = "/materials/?view=tree";
             var lst = $("#materials_list");
             lst.html("");
 
@@ -210,26 +269,37 @@ var Suggester = {
                 if (data.length == 0) {
                     $("#suggest_help").text("Pas d'emballage disponible");
                 } else {
-                    for (var i = 0; i < data.length; i++) {
-                        var v = data[i]
-                        self.addMaterialItem(lst, v.id, v.name);
-                    }
+                    self.addMaterialTree(lst, data, 0);
 
                     if (self.app.product != null) {
-                        for (var i = 0; i < self.app.product.materials.length; i++) {
-                            var id = self.app.product.materials[i].id;
+                        var checked = self.app.product.materials;
+                        if (checked.length == 0 && self.app.product.suggested_materials) {
+                            checked = self.app.product.suggested_materials;
+                        }
+                        for (var i = 0; i < checked.length; i++) {
+                            var id = checked[i].id;
                             $("#materialId-" + id.toString()).prop("checked", true);
                         }
                     }
                 }
             }).fail(function(xhr) {
-                $("#suggest_help").html(xhr.responseText.replace(/\n/g, "<br>"));
+                $("#suggest_help").text(errorMessage(xhr));
             });
         });
     },
 
-    addMaterialItem: function(lst, id, name) {
-        lst.append('<div class="checkbox col-sm-4 suggest-checkbox"><label for="materialId-' + id + '"><input type="checkbox" value="" id="materialId-' + id + '">' + name + '</label></div>');
+    addMaterialTree: function(lst, nodes, depth) {
+        for (var i = 0; i < nodes.length; i++) {
+            var v = nodes[i];
+            this.addMaterialItem(lst, v.id, v.name, depth);
+            if (v.children) {
+                this.addMaterialTree(lst, v.children, depth + 1);
+            }
+        }
+    },
+
+    addMaterialItem: function(lst, id, name, depth) {
+        lst.append('<div class="checkbox col-sm-12 suggest-checkbox" style="padding-left: ' + (15 + depth * 20) + 'px"><label for="materialId-' + id + '"><input type="checkbox" value="" id="materialId-' + id + '">' + name + '</label></div>');
     },
 
     detachListeners: function() {
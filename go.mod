@@ -3,11 +3,11 @@ module github.com/jfyuen/recycleme
 go 1.14
 
 require (
-	github.com/nicholassm/go-ean v0.0.0-20160503113020-c3635ff48801
+	github.com/andybalholm/cascadia v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	golang.org/x/net v0.17.0
-	golang.org/x/text v0.13.0
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/mgo.v2 v2.0.0-20160316054952-b6e2fa371e64
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
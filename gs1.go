@@ -0,0 +1,222 @@
+package recycleme
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// BarcodeCategory is the kind of code a GTIN is, according to its GS1 prefix
+type BarcodeCategory string
+
+const (
+	CategoryProduct    BarcodeCategory = "product"    // trade item, registered by a company
+	CategoryRestricted BarcodeCategory = "restricted" // restricted circulation, e.g. store brands or products sold by weight, only meaningful in a store
+	CategoryBook       BarcodeCategory = "book"       // ISBN (Bookland 978 and 979)
+	CategoryPeriodical BarcodeCategory = "periodical" // ISSN (977)
+	CategoryCoupon     BarcodeCategory = "coupon"     // coupons and refund receipts
+)
+
+// BarcodeInfo is what the GS1 prefix of a barcode tells about it
+type BarcodeInfo struct {
+	GTIN     string          `json:"gtin"`              // canonical GTIN, see NormalizeBarcode
+	Prefix   string          `json:"prefix"`            // GS1 prefix, 3 digits
+	Country  string          `json:"country,omitempty"` // country of the GS1 organisation which registered the code, not where the product was made
+	Category BarcodeCategory `json:"category"`
+}
+
+// gs1Range is a range of 3 digits GS1 prefixes
+type gs1Range struct {
+	From, To int
+	Country  string
+	Category BarcodeCategory
+}
+
+// gs1Prefixes are the GS1 prefixes allocated to member organisations and special uses, sorted.
+// Unlisted prefixes are unassigned.
+var gs1Prefixes = []gs1Range{
+	{0, 19, "United States and Canada", CategoryProduct},
+	{20, 29, "", CategoryRestricted},
+	{30, 39, "United States", CategoryProduct},
+	{40, 49, "", CategoryRestricted},
+	{50, 59, "", CategoryCoupon},
+	{60, 139, "United States and Canada", CategoryProduct},
+	{200, 299, "", CategoryRestricted},
+	{300, 379, "France and Monaco", CategoryProduct},
+	{380, 380, "Bulgaria", CategoryProduct},
+	{383, 383, "Slovenia", CategoryProduct},
+	{385, 385, "Croatia", CategoryProduct},
+	{387, 387, "Bosnia and Herzegovina", CategoryProduct},
+	{389, 389, "Montenegro", CategoryProduct},
+	{390, 390, "Kosovo", CategoryProduct},
+	{400, 440, "Germany", CategoryProduct},
+	{450, 459, "Japan", CategoryProduct},
+	{460, 469, "Russia", CategoryProduct},
+	{470, 470, "Kyrgyzstan", CategoryProduct},
+	{471, 471, "Taiwan", CategoryProduct},
+	{474, 474, "Estonia", CategoryProduct},
+	{475, 475, "Latvia", CategoryProduct},
+	{476, 476, "Azerbaijan", CategoryProduct},
+	{477, 477, "Lithuania", CategoryProduct},
+	{478, 478, "Uzbekistan", CategoryProduct},
+	{479, 479, "Sri Lanka", CategoryProduct},
+	{480, 480, "Philippines", CategoryProduct},
+	{481, 481, "Belarus", CategoryProduct},
+	{482, 482, "Ukraine", CategoryProduct},
+	{483, 483, "Turkmenistan", CategoryProduct},
+	{484, 484, "Moldova", CategoryProduct},
+	{485, 485, "Armenia", CategoryProduct},
+	{486, 486, "Georgia", CategoryProduct},
+	{487, 487, "Kazakhstan", CategoryProduct},
+	{488, 488, "Tajikistan", CategoryProduct},
+	{489, 489, "Hong Kong", CategoryProduct},
+	{490, 499, "Japan", CategoryProduct},
+	{500, 509, "United Kingdom", CategoryProduct},
+	{520, 521, "Greece", CategoryProduct},
+	{528, 528, "Lebanon", CategoryProduct},
+	{529, 529, "Cyprus", CategoryProduct},
+	{530, 530, "Albania", CategoryProduct},
+	{531, 531, "North Macedonia", CategoryProduct},
+	{535, 535, "Malta", CategoryProduct},
+	{539, 539, "Ireland", CategoryProduct},
+	{540, 549, "Belgium and Luxembourg", CategoryProduct},
+	{560, 560, "Portugal", CategoryProduct},
+	{569, 569, "Iceland", CategoryProduct},
+	{570, 579, "Denmark", CategoryProduct},
+	{590, 590, "Poland", CategoryProduct},
+	{594, 594, "Romania", CategoryProduct},
+	{599, 599, "Hungary", CategoryProduct},
+	{600, 601, "South Africa", CategoryProduct},
+	{603, 603, "Ghana", CategoryProduct},
+	{604, 604, "Senegal", CategoryProduct},
+	{608, 608, "Bahrain", CategoryProduct},
+	{609, 609, "Mauritius", CategoryProduct},
+	{611, 611, "Morocco", CategoryProduct},
+	{613, 613, "Algeria", CategoryProduct},
+	{615, 615, "Nigeria", CategoryProduct},
+	{616, 616, "Kenya", CategoryProduct},
+	{618, 618, "Côte d'Ivoire", CategoryProduct},
+	{619, 619, "Tunisia", CategoryProduct},
+	{620, 620, "Tanzania", CategoryProduct},
+	{621, 621, "Syria", CategoryProduct},
+	{622, 622, "Egypt", CategoryProduct},
+	{623, 623, "Brunei", CategoryProduct},
+	{624, 624, "Libya", CategoryProduct},
+	{625, 625, "Jordan", CategoryProduct},
+	{626, 626, "Iran", CategoryProduct},
+	{627, 627, "Kuwait", CategoryProduct},
+	{628, 628, "Saudi Arabia", CategoryProduct},
+	{629, 629, "United Arab Emirates", CategoryProduct},
+	{640, 649, "Finland", CategoryProduct},
+	{690, 699, "China", CategoryProduct},
+	{700, 709, "Norway", CategoryProduct},
+	{729, 729, "Israel", CategoryProduct},
+	{730, 739, "Sweden", CategoryProduct},
+	{740, 740, "Guatemala", CategoryProduct},
+	{741, 741, "El Salvador", CategoryProduct},
+	{742, 742, "Honduras", CategoryProduct},
+	{743, 743, "Nicaragua", CategoryProduct},
+	{744, 744, "Costa Rica", CategoryProduct},
+	{745, 745, "Panama", CategoryProduct},
+	{746, 746, "Dominican Republic", CategoryProduct},
+	{750, 750, "Mexico", CategoryProduct},
+	{754, 755, "Canada", CategoryProduct},
+	{759, 759, "Venezuela", CategoryProduct},
+	{760, 769, "Switzerland and Liechtenstein", CategoryProduct},
+	{770, 771, "Colombia", CategoryProduct},
+	{773, 773, "Uruguay", CategoryProduct},
+	{775, 775, "Peru", CategoryProduct},
+	{777, 777, "Bolivia", CategoryProduct},
+	{778, 779, "Argentina", CategoryProduct},
+	{780, 780, "Chile", CategoryProduct},
+	{784, 784, "Paraguay", CategoryProduct},
+	{786, 786, "Ecuador", CategoryProduct},
+	{789, 790, "Brazil", CategoryProduct},
+	{800, 839, "Italy", CategoryProduct},
+	{840, 849, "Spain and Andorra", CategoryProduct},
+	{850, 850, "Cuba", CategoryProduct},
+	{858, 858, "Slovakia", CategoryProduct},
+	{859, 859, "Czech Republic", CategoryProduct},
+	{860, 860, "Serbia", CategoryProduct},
+	{865, 865, "Mongolia", CategoryProduct},
+	{867, 867, "North Korea", CategoryProduct},
+	{868, 869, "Turkey", CategoryProduct},
+	{870, 879, "Netherlands", CategoryProduct},
+	{880, 880, "South Korea", CategoryProduct},
+	{884, 884, "Cambodia", CategoryProduct},
+	{885, 885, "Thailand", CategoryProduct},
+	{888, 888, "Singapore", CategoryProduct},
+	{890, 890, "India", CategoryProduct},
+	{893, 893, "Vietnam", CategoryProduct},
+	{896, 896, "Pakistan", CategoryProduct},
+	{899, 899, "Indonesia", CategoryProduct},
+	{900, 919, "Austria", CategoryProduct},
+	{930, 939, "Australia", CategoryProduct},
+	{940, 949, "New Zealand", CategoryProduct},
+	{950, 951, "GS1 Global Office", CategoryProduct},
+	{955, 955, "Malaysia", CategoryProduct},
+	{958, 958, "Macau", CategoryProduct},
+	{960, 969, "GS1 Global Office", CategoryProduct},
+	{977, 977, "", CategoryPeriodical},
+	{978, 979, "", CategoryBook},
+	{980, 999, "", CategoryCoupon},
+}
+
+// lookupGS1Prefix returns the range of a 3 digits prefix, false if it is unassigned
+func lookupGS1Prefix(prefix int) (gs1Range, bool) {
+	i := sort.Search(len(gs1Prefixes), func(i int) bool { return gs1Prefixes[i].To >= prefix })
+	if i < len(gs1Prefixes) && gs1Prefixes[i].From <= prefix {
+		return gs1Prefixes[i], true
+	}
+	return gs1Range{}, false
+}
+
+// DecodeBarcode normalizes code and decodes its GS1 prefix.
+// The prefix of a GTIN-14 follows its indicator digit. EAN-8 starting with 0 or 2 are restricted circulation codes.
+// Codes with an unassigned prefix are products of an unknown country.
+func DecodeBarcode(code string) (BarcodeInfo, error) {
+	gtin, err := NormalizeBarcode(code)
+	if err != nil {
+		return BarcodeInfo{}, err
+	}
+	info := BarcodeInfo{GTIN: gtin, Prefix: gtin[:3], Category: CategoryProduct}
+	switch len(gtin) {
+	case 8:
+		if gtin[0] == '0' || gtin[0] == '2' {
+			info.Category = CategoryRestricted
+			return info, nil
+		}
+	case 14:
+		info.Prefix = gtin[1:4]
+	}
+	prefix, _ := strconv.Atoi(info.Prefix)
+	if r, ok := lookupGS1Prefix(prefix); ok {
+		info.Country = r.Country
+		info.Category = r.Category
+	}
+	return info, nil
+}
+
+// Notice explains codes which cannot be found in product databases, empty for other codes
+func (info BarcodeInfo) Notice() string {
+	switch info.Category {
+	case CategoryRestricted:
+		return fmt.Sprintf("%v is a restricted circulation code: it is assigned by a store to its own products (e.g. sold by weight), and is unknown outside of this store", info.GTIN)
+	case CategoryCoupon:
+		return fmt.Sprintf("%v is a coupon, not a product", info.GTIN)
+	}
+	return ""
+}
+
+// categoriesFetcher is a Fetcher which only holds some categories of codes, DefaultFetcher skips it for the other ones
+type categoriesFetcher interface {
+	AcceptsCategory(c BarcodeCategory) bool
+}
+
+// acceptsCategory returns true if f may hold codes of category c, fetchers which do not declare categories accept all of them
+func acceptsCategory(f Fetcher, c BarcodeCategory) bool {
+	if cf, ok := f.(categoriesFetcher); ok {
+		return cf.AcceptsCategory(c)
+	}
+	return true
+}
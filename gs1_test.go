@@ -0,0 +1,118 @@
+package recycleme
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDecodeBarcode(t *testing.T) {
+	for code, expected := range map[string]BarcodeInfo{
+		"3017620422003":  {GTIN: "3017620422003", Prefix: "301", Country: "France and Monaco", Category: CategoryProduct},
+		"5029053038896":  {GTIN: "5029053038896", Prefix: "502", Country: "United Kingdom", Category: CategoryProduct},
+		"012345678905":   {GTIN: "0012345678905", Prefix: "001", Country: "United States and Canada", Category: CategoryProduct},
+		"2000000000015":  {GTIN: "2000000000015", Prefix: "200", Category: CategoryRestricted},
+		"0212345678909":  {GTIN: "0212345678909", Prefix: "021", Category: CategoryRestricted},
+		"0412345678903":  {GTIN: "0412345678903", Prefix: "041", Category: CategoryRestricted},
+		"9771674821123":  {GTIN: "9771674821123", Prefix: "977", Category: CategoryPeriodical},
+		"0306406152":     {GTIN: "9780306406157", Prefix: "978", Category: CategoryBook},
+		"9912345678909":  {GTIN: "9912345678909", Prefix: "991", Category: CategoryCoupon},
+		"96385074":       {GTIN: "96385074", Prefix: "963", Country: "GS1 Global Office", Category: CategoryProduct},
+		"20123451":       {GTIN: "20123451", Prefix: "201", Category: CategoryRestricted},
+		"13017620422000": {GTIN: "13017620422000", Prefix: "301", Country: "France and Monaco", Category: CategoryProduct},
+		"6701234567898":  {GTIN: "6701234567898", Prefix: "670", Category: CategoryProduct},
+	} {
+		info, err := DecodeBarcode(code)
+		if err != nil {
+			t.Errorf("%v: %v", code, err)
+		} else if info != expected {
+			t.Errorf("%v: expected %+v, got %+v", code, expected, info)
+		}
+	}
+	if _, err := DecodeBarcode("invalid"); err != errInvalidEAN {
+		t.Errorf("expected %v, got %v", errInvalidEAN, err)
+	}
+
+	for i, r := range gs1Prefixes {
+		if r.From > r.To || (i > 0 && gs1Prefixes[i-1].To >= r.From) {
+			t.Errorf("gs1 prefixes must be sorted and not overlap: %+v", r)
+		}
+	}
+}
+
+// bookFetcher only holds books
+type bookFetcher struct {
+	countingFetcher
+}
+
+func (f bookFetcher) AcceptsCategory(c BarcodeCategory) bool {
+	return c == CategoryBook
+}
+
+func TestDefaultFetcherCategories(t *testing.T) {
+	productCalls, bookCalls, anyCalls := int32(0), int32(0), int32(0)
+	products := FetchableURL{URL: "http://www.example.com/%s", WebsiteName: "products", Categories: []BarcodeCategory{CategoryProduct}}
+	fetcher := DefaultFetcher{fetchers: []Fetcher{
+		newBreakerFetcher(testCategoriesFetcher{products, &productCalls}),
+		newBreakerFetcher(bookFetcher{countingFetcher{calls: &bookCalls, err: errNotFound}}),
+		countingFetcher{calls: &anyCalls, err: errNotFound},
+	}}
+
+	if _, err := fetcher.Fetch(context.Background(), "0306406152", blacklistDB); !isNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if productCalls != 0 || bookCalls != 1 || anyCalls != 1 {
+		t.Errorf("only books sources should be queried for an ISBN, got %v product, %v book and %v other calls", productCalls, bookCalls, anyCalls)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), "2000000000015", blacklistDB); !isNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	} else if !strings.Contains(err.Error(), errUnsupportedBarcode.Error()) {
+		t.Errorf("skipped sources should be reported: %v", err)
+	}
+	if productCalls != 0 || bookCalls != 1 || anyCalls != 2 {
+		t.Errorf("only sources without categories should be queried for a restricted code, got %v product, %v book and %v other calls", productCalls, bookCalls, anyCalls)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), "5029053038896", blacklistDB); err != nil {
+		t.Error(err)
+	}
+	if productCalls != 1 {
+		t.Errorf("products sources should be queried for products, got %v calls", productCalls)
+	}
+}
+
+// testCategoriesFetcher counts calls to a FetchableURL instead of fetching it
+type testCategoriesFetcher struct {
+	FetchableURL
+	calls *int32
+}
+
+func (f testCategoriesFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
+	atomic.AddInt32(f.calls, 1)
+	return Product{EAN: ean, Name: "TEST"}, nil
+}
+
+func TestThrowAwayHandlerRestricted(t *testing.T) {
+	calls := int32(0)
+	handler := ThrowAwayHandler{
+		DB:          packageDB,
+		BlacklistDB: blacklistDB,
+		Fetcher:     countingFetcher{calls: &calls, err: newProductError("2000000000015", "/local/", errNotFound)},
+	}
+	req, err := http.NewRequest("GET", "/throwaway/2000000000015", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if !strings.Contains(rr.Body.String(), "restricted circulation code") {
+		t.Errorf("restricted code should be explained, got %v", rr.Body.String())
+	}
+}
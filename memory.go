@@ -0,0 +1,385 @@
+package recycleme
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDB is a thread-safe in-memory storage, used for demos, offline development and tests.
+// It holds the same data as the mongodb collections: bins, materials, materials_to_bins, packages, blacklist, local_products and product_cache.
+type MemoryDB struct {
+	mu              sync.RWMutex
+	bins            map[uint]Bin
+	materials       map[uint]Material
+	materialsToBins []BinRule
+	preparations    []Preparation
+	packages        map[string][]uint
+	blacklist       map[string]struct{}
+	localProducts   []Product
+	productCache    map[string]CachedProduct
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		bins:         make(map[uint]Bin),
+		materials:    make(map[uint]Material),
+		packages:     make(map[string][]uint),
+		blacklist:    make(map[string]struct{}),
+		productCache: make(map[string]CachedProduct),
+	}
+}
+
+// LoadBins reads a json list of Bin
+func (db *MemoryDB) LoadBins(r io.Reader) error {
+	var bins []Bin
+	if err := json.NewDecoder(r).Decode(&bins); err != nil {
+		return err
+	}
+	for _, b := range bins {
+		if err := validateBin(b); err != nil {
+			return err
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, b := range bins {
+		db.bins[b.ID] = b
+	}
+	return nil
+}
+
+// LoadMaterials reads a json list of Material, with their "parent_id" in the taxonomy.
+// If a material has a "bin_id" field, it is also added to the default rules of materials_to_bins.
+func (db *MemoryDB) LoadMaterials(r io.Reader) error {
+	var materialsWithBinID []struct {
+		Material `json:",inline"`
+		BinID    uint `json:"bin_id"`
+	}
+	if err := json.NewDecoder(r).Decode(&materialsWithBinID); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	materials := make(map[uint]Material, len(db.materials)+len(materialsWithBinID))
+	for id, m := range db.materials {
+		materials[id] = m
+	}
+	for _, m := range materialsWithBinID {
+		materials[m.ID] = m.Material
+	}
+	if err := validateMaterialParents(materials); err != nil {
+		return err
+	}
+	db.materials = materials
+	for _, m := range materialsWithBinID {
+		if m.BinID != 0 {
+			db.materialsToBins = append(db.materialsToBins, BinRule{MaterialID: m.ID, BinID: m.BinID})
+		}
+	}
+	return nil
+}
+
+// LoadMaterialsToBins reads a json list of BinRule, e.g. {"material_id": X, "bin_id": Y, "region": Z}, rules without region are the default ones
+func (db *MemoryDB) LoadMaterialsToBins(r io.Reader) error {
+	var rules []BinRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return err
+	}
+	return memoryPackagesDB{MemoryDB: db}.AddBinRules(rules)
+}
+
+// LoadPreparations reads a json list of Preparation
+func (db *MemoryDB) LoadPreparations(r io.Reader) error {
+	preparations, err := decodePreparations(r)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.preparations = append(db.preparations, preparations...)
+	return nil
+}
+
+// LoadPackages reads a json list of {"ean": X, "material_ids": [...]}, stored by canonical GTIN (see NormalizeBarcode)
+func (db *MemoryDB) LoadPackages(r io.Reader) error {
+	var packages []mgoPackageItem
+	if err := json.NewDecoder(r).Decode(&packages); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, p := range packages {
+		db.packages[canonicalEAN(p.EAN)] = p.MaterialIDs
+	}
+	return nil
+}
+
+// LoadLocalProducts reads a json list of Product
+func (db *MemoryDB) LoadLocalProducts(r io.Reader) error {
+	var products []Product
+	if err := json.NewDecoder(r).Decode(&products); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.localProducts = append(db.localProducts, products...)
+	return nil
+}
+
+type memoryPackagesDB struct {
+	*MemoryDB
+}
+
+func NewMemoryPackageDB(db *MemoryDB) *memoryPackagesDB {
+	return &memoryPackagesDB{MemoryDB: db}
+}
+
+func (db memoryPackagesDB) GetAll() ([]Material, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	m := make([]Material, 0, len(db.materials))
+	for _, material := range db.materials {
+		m = append(m, material)
+	}
+	sort.Slice(m, func(i, j int) bool { return m[i].Name < m[j].Name })
+	return m, nil
+}
+
+func (db memoryPackagesDB) Get(ean string) (Package, error) {
+	ean = canonicalEAN(ean)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	p := Package{EAN: ean}
+	materialIDs, ok := db.packages[ean]
+	if !ok {
+		return p, errPackageNotFound
+	}
+	for _, id := range materialIDs {
+		if m, ok := db.materials[id]; ok {
+			p.Materials = append(p.Materials, m)
+		}
+	}
+	return p, nil
+}
+
+func (db memoryPackagesDB) Set(ean string, m []Material) error {
+	ean, err := NormalizeBarcode(ean)
+	if err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		return errors.New("no materials to add")
+	}
+	materialIDSet := make(map[uint]struct{})
+	var materialIDs []uint
+	for _, material := range m {
+		if _, ok := materialIDSet[material.ID]; ok {
+			continue
+		}
+		materialIDSet[material.ID] = struct{}{}
+		materialIDs = append(materialIDs, material.ID)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.packages[ean] = materialIDs
+	return nil
+}
+
+// GetBins returns the bin of each material in region at a date, from the valid rules of its most specific region
+// for the material or its ancestors
+func (db memoryPackagesDB) GetBins(m []Material, region Region, at time.Time) (map[Material]Bin, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	r := make(map[Material]Bin)
+	materials := make([]Material, 0, len(db.materials))
+	for _, material := range db.materials {
+		materials = append(materials, material)
+	}
+	binIDs := mostSpecificBins(db.materialsToBins, region.Codes(), at, materialParents(materials))
+	for _, material := range m {
+		if binID, ok := binIDs[material.ID]; ok {
+			r[material] = db.bins[binID]
+		}
+	}
+	return r, nil
+}
+
+// GetPreparations returns the preparation of each material from its most specific region, for the material or its ancestors
+func (db memoryPackagesDB) GetPreparations(m []Material, r Region) (map[uint]Preparation, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	materials := make([]Material, 0, len(db.materials))
+	for _, material := range db.materials {
+		materials = append(materials, material)
+	}
+	preparations := mostSpecificPreparations(db.preparations, r.Codes(), materialParents(materials))
+	out := make(map[uint]Preparation)
+	for _, material := range m {
+		if p, ok := preparations[material.ID]; ok {
+			out[material.ID] = p
+		}
+	}
+	return out, nil
+}
+
+func (db memoryPackagesDB) BinRules(r Region) ([]BinRule, error) {
+	codes := make(map[string]bool)
+	for _, code := range r.Codes() {
+		codes[code] = true
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var rules []BinRule
+	for _, rule := range db.materialsToBins {
+		if codes[rule.Region] {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (db memoryPackagesDB) AddBinRules(rules []BinRule) error {
+	normalized := make([]BinRule, 0, len(rules))
+	for _, rule := range rules {
+		rule, err := normalizeBinRule(rule)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, rule)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.materialsToBins = append(db.materialsToBins, normalized...)
+	return nil
+}
+
+type memoryBlacklistDB struct {
+	*MemoryDB
+}
+
+func NewMemoryBlacklistDB(db *MemoryDB) *memoryBlacklistDB {
+	return &memoryBlacklistDB{MemoryDB: db}
+}
+
+func (db memoryBlacklistDB) Contains(url string) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, ok := db.blacklist[url]
+	return ok, nil
+}
+
+func (db memoryBlacklistDB) Add(url string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.blacklist[url] = struct{}{}
+	return nil
+}
+
+type memoryLocalProductDB struct {
+	*MemoryDB
+}
+
+func NewMemoryLocalProductDB(db *MemoryDB) *memoryLocalProductDB {
+	return &memoryLocalProductDB{MemoryDB: db}
+}
+
+// AddProduct stores a Product, it will be returned by Fetch
+func (db memoryLocalProductDB) AddProduct(p Product) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.localProducts = append(db.localProducts, p)
+}
+
+func (db memoryLocalProductDB) Fetch(ctx context.Context, ean string, blacklist BlacklistDB) (Product, error) {
+	if err := ctx.Err(); err != nil {
+		return Product{}, newProductError(ean, "/local/", err)
+	}
+	db.mu.RLock()
+	var products []Product
+	for _, p := range db.localProducts {
+		if p.EAN == ean {
+			products = append(products, p)
+		}
+	}
+	db.mu.RUnlock()
+
+	if len(products) == 0 {
+		return Product{}, newProductError(ean, "/local/", errNotFound)
+	}
+	var err error
+	for _, p := range products {
+		url := "/local/" + p.WebsiteName + "/" + p.EAN
+		var product Product
+		product, err = withCheckInBlacklist(blacklist, ean, url, func() (Product, error) {
+			return p, nil
+		})
+		if err != nil {
+			continue
+		}
+		return product, nil
+	}
+	return Product{}, err
+}
+
+func (db memoryLocalProductDB) Name() string {
+	return LocalFetcherName
+}
+
+func (db memoryLocalProductDB) IsURLValidForEAN(myURL, ean string) bool {
+	if !strings.HasPrefix(myURL, "/local/") {
+		return false
+	}
+	// Looking for WebsiteName in /local/WebsiteName/EAN
+	websiteName := strings.TrimSuffix(strings.TrimPrefix(myURL, "/local/"), "/"+ean)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	count := 0
+	for _, p := range db.localProducts {
+		if p.EAN == ean && p.WebsiteName == websiteName {
+			count++
+		}
+	}
+	return count == 1
+}
+
+type memoryProductCacheDB struct {
+	*MemoryDB
+}
+
+func NewMemoryProductCacheDB(db *MemoryDB) *memoryProductCacheDB {
+	return &memoryProductCacheDB{MemoryDB: db}
+}
+
+func (db memoryProductCacheDB) Get(ean string) (CachedProduct, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	c, ok := db.productCache[ean]
+	return c, ok, nil
+}
+
+func (db memoryProductCacheDB) Set(c CachedProduct) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.productCache[c.EAN] = c
+	return nil
+}
+
+func (db memoryProductCacheDB) Delete(ean string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.productCache, ean)
+	return nil
+}
+
+func (db memoryProductCacheDB) Purge() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.productCache = make(map[string]CachedProduct)
+	return nil
+}
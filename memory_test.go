@@ -0,0 +1,120 @@
+package recycleme
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryDBLoad(t *testing.T) {
+	db := NewMemoryDB()
+	if err := db.LoadBins(strings.NewReader(binsJSON)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadMaterials(strings.NewReader(`[{"id": 1, "name": "Boîte carton"}, {"id": 2, "name": "Film plastique"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadMaterialsToBins(strings.NewReader(`[{"material_id": 1, "bin_id": 2}, {"material_id": 2, "bin_id": 1}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadBins(strings.NewReader(`[{"id": 5, "name": "Pharmacie", "collection_type": "pharmacie"}]`)); err == nil {
+		t.Error("bins with an unknown collection type should not be loaded")
+	}
+	if err := db.LoadBins(strings.NewReader(`[{"id": 5, "name": "Bac jaune", "color": "yellow"}]`)); err == nil {
+		t.Error("bins with an invalid colour should not be loaded")
+	}
+	if err := db.LoadPreparations(strings.NewReader(`[{"material_id": 1, "region": "Lyon", "steps": ["aplatir la boîte"]}]`)); !errors.Is(err, errInvalidRegion) {
+		t.Errorf("preparations must have a valid region, got %v", err)
+	}
+	if err := db.LoadMaterials(strings.NewReader(`{"invalid": true}`)); err == nil {
+		t.Error("invalid json should not be loaded")
+	}
+	if err := db.LoadMaterials(strings.NewReader(`[{"id": 3, "name": "PET", "parent_id": 42}]`)); !errors.Is(err, errInvalidMaterial) {
+		t.Errorf("materials must have a known parent, got %v", err)
+	}
+	if err := db.LoadMaterialsToBins(strings.NewReader(`[{"material_id": 1, "bin_id": 2, "region": "FR-75011,FR-200054781"}]`)); !errors.Is(err, errInvalidRegion) {
+		t.Errorf("rules must have a single region code, got %v", err)
+	}
+
+	packageDB := NewMemoryPackageDB(db)
+	materials, err := packageDB.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(materials) != 2 || materials[0].Name != "Boîte carton" || materials[1].Name != "Film plastique" {
+		t.Fatalf("materials not loaded or not sorted: %v", materials)
+	}
+
+	// packages are stored by canonical GTIN
+	if err := db.LoadPackages(strings.NewReader(`[{"ean": "036000291452", "material_ids": [1]}, {"ean": "0000040170725", "material_ids": [2]}]`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ean := range []string{"0036000291452", "40170725"} {
+		if pkg, err := packageDB.Get(ean); err != nil || len(pkg.Materials) != 1 {
+			t.Errorf("%v: package not found, got %v, %v", ean, pkg, err)
+		}
+	}
+
+	bins, err := packageDB.GetBins(materials, Region{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bins[materials[0]].Name != "Bac à couvercle jaune" || bins[materials[1]].Name != "Bac à couvercle vert" {
+		t.Errorf("invalid bins for %v: %v", materials, bins)
+	}
+}
+
+func TestMemoryDBConcurrency(t *testing.T) {
+	db := NewMemoryDB()
+	if err := db.LoadMaterials(strings.NewReader(materialsJSON)); err != nil {
+		t.Fatal(err)
+	}
+	packageDB := NewMemoryPackageDB(db)
+	blacklistDB := NewMemoryBlacklistDB(db)
+	m := []Material{{ID: 1, Name: "Boîte carton"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := packageDB.Set("7613034383808", m); err != nil {
+				t.Error(err)
+			}
+			if _, err := packageDB.Get("7613034383808"); err != nil {
+				t.Error(err)
+			}
+			if err := blacklistDB.Add("http://www.example.com"); err != nil {
+				t.Error(err)
+			}
+			if _, err := blacklistDB.Contains("http://www.example.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMemoryLocalProductDB(t *testing.T) {
+	db := NewMemoryDB()
+	localDB := NewMemoryLocalProductDB(db)
+	blacklist := NewMemoryBlacklistDB(db)
+	localDB.AddProduct(Product{EAN: "3057640136573", Name: "name_test", WebsiteName: "website_name_test"})
+
+	if _, err := localDB.Fetch(context.Background(), "5029053038896", blacklist); err == nil {
+		t.Error("product should not be found")
+	} else if err.(*productError).err != errNotFound {
+		t.Errorf("not a not found error: %v", err)
+	}
+
+	if err := blacklist.Add("/local/website_name_test/3057640136573"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := localDB.Fetch(context.Background(), "3057640136573", blacklist); err == nil {
+		t.Error("product should be blacklisted")
+	} else if err.(*productError).err != errBlacklisted {
+		t.Errorf("not a blacklist error: %v", err)
+	}
+}
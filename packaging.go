@@ -4,22 +4,65 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	eancheck "github.com/nicholassm/go-ean"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"io"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
+// CollectionType is how the content of a Bin is collected
+type CollectionType string
+
+const (
+	CollectionKerbside        CollectionType = "kerbside"         // bins of buildings and houses, emptied by the collectivity
+	CollectionDropOff         CollectionType = "drop_off"         // voluntary drop-off points in the street, e.g. glass containers
+	CollectionRecyclingCentre CollectionType = "recycling_centre" // déchèterie
+	CollectionPharmacy        CollectionType = "pharmacy"         // medicines, brought back to pharmacies
+	CollectionTakeBack        CollectionType = "take_back"        // taken back by shops, e.g. batteries or light bulbs
+)
+
+var collectionTypes = map[CollectionType]bool{
+	CollectionKerbside:        true,
+	CollectionDropOff:         true,
+	CollectionRecyclingCentre: true,
+	CollectionPharmacy:        true,
+	CollectionTakeBack:        true,
+}
+
+// Bin is where materials are thrown away, with what users need to recognize and use it
 type Bin struct {
-	Name string `json:"name" bson:"name"`
-	ID   uint   `json:"id" bson:"_id,omitempty"`
+	Name           string         `json:"name" bson:"name"`
+	ID             uint           `json:"id" bson:"_id,omitempty"`
+	Color          string         `json:"color,omitempty" bson:"color,omitempty"`                     // colour of the lid, as an HTML colour code, e.g. #f7d117
+	IconURL        string         `json:"icon_url,omitempty" bson:"icon_url,omitempty"`               // pictogram of the bin
+	Instructions   string         `json:"instructions,omitempty" bson:"instructions,omitempty"`       // e.g. empty, do not rinse, do not nest
+	CollectionType CollectionType `json:"collection_type,omitempty" bson:"collection_type,omitempty"` // kerbside by default
 }
 
+// validateBin returns an error if the collection type or colour of b is unknown
+func validateBin(b Bin) error {
+	if b.CollectionType != "" && !collectionTypes[b.CollectionType] {
+		return fmt.Errorf("unknown collection type %q for bin %v", b.CollectionType, b.Name)
+	}
+	if b.Color != "" && !htmlColor.MatchString(b.Color) {
+		return fmt.Errorf("invalid color %q for bin %v, expected #rrggbb", b.Color, b.Name)
+	}
+	return nil
+}
+
+var htmlColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 // A Material composes Packaging, different Materials go to different Bin, event ones that may be close enough
 // For example, in Paris, plastic bags go to the green bin, but plastic bottles go to the yellow bin
+// Materials are organized as a taxonomy (family > material > form, e.g. Plastique > PET > Bouteille PET, see MaterialTree):
+// a material without bin rule of its own is thrown away as its closest ancestor.
 type Material struct {
-	ID   uint   `json:"id" bson:"_id,omitempty"`
-	Name string `json:"name" bson:"name"`
+	ID       uint   `json:"id" bson:"_id,omitempty"`
+	Name     string `json:"name" bson:"name"`
+	ParentID uint   `json:"parent_id,omitempty" bson:"parent_id,omitempty"` // 0 for families
 }
 
 // Packaging related to a Product
@@ -40,7 +83,9 @@ func (p Package) String() string {
 
 type PackagesDB interface {
 	Get(ean string) (Package, error)
-	GetBins([]Material) (map[Material]Bin, error)
+	GetBins(m []Material, r Region, at time.Time) (map[Material]Bin, error)
+	// GetPreparations returns the preparation of each material ID from its most specific region, materials without preparation are skipped
+	GetPreparations(m []Material, r Region) (map[uint]Preparation, error)
 	Set(ean string, m []Material) error
 }
 
@@ -73,7 +118,7 @@ func (db mgoPackagesDB) GetAll() ([]Material, error) {
 
 type mgoPackagesDB struct {
 	mgoDB
-	packagesColName, materialsColName, binsColName, materialsToBinsColName string
+	packagesColName, materialsColName, binsColName, materialsToBinsColName, preparationsColName string
 }
 
 type mgoPackageItem struct {
@@ -87,16 +132,25 @@ func NewMgoPackageDB(s *mgo.Session, colPrefix string) *mgoPackagesDB {
 		materialsColName:       colPrefix + "materials",
 		binsColName:            colPrefix + "bins",
 		materialsToBinsColName: colPrefix + "materials_to_bins",
+		preparationsColName:    colPrefix + "material_preparations",
 	}
 }
 
+// Get returns the package of ean, stored by canonical GTIN.
+// Packages stored before barcodes were normalized are found under their former key (see legacyEANs).
 func (db mgoPackagesDB) Get(ean string) (Package, error) {
+	legacy := legacyEANs(ean)
+	ean = canonicalEAN(ean)
 	p := Package{EAN: ean}
 	err := withMgoSession(db.session, func(s *mgo.Session) error {
 		localDB := s.DB("")
 		collection := localDB.C(db.packagesColName)
 		item := mgoPackageItem{}
-		if err := collection.Find(bson.M{"ean": ean}).One(&item); err != nil {
+		err := collection.Find(bson.M{"ean": ean}).One(&item)
+		if err == mgo.ErrNotFound && len(legacy) > 0 {
+			err = collection.Find(bson.M{"ean": bson.M{"$in": legacy}}).One(&item)
+		}
+		if err != nil {
 			if err == mgo.ErrNotFound {
 				return errPackageNotFound
 			}
@@ -114,8 +168,9 @@ func (db mgoPackagesDB) Get(ean string) (Package, error) {
 }
 
 func (db mgoPackagesDB) Set(ean string, m []Material) error {
-	if !eancheck.Valid(ean) {
-		return errInvalidEAN
+	ean, err := NormalizeBarcode(ean)
+	if err != nil {
+		return err
 	}
 	if len(m) == 0 {
 		return errors.New("no materials to add")
@@ -138,26 +193,33 @@ func (db mgoPackagesDB) Set(ean string, m []Material) error {
 	})
 }
 
-func (db mgoPackagesDB) GetBins(m []Material) (map[Material]Bin, error) {
+// GetBins returns the bin of each material in region at a date, from the valid rules of its most specific region
+// for the material or its ancestors.
+// Rules without a region field are the default ones.
+func (db mgoPackagesDB) GetBins(m []Material, region Region, at time.Time) (map[Material]Bin, error) {
 	r := make(map[Material]Bin)
 	return r, withMgoSession(db.session, func(s *mgo.Session) error {
-		mIDs := make([]uint, len(m), len(m))
+		var withParent []Material
+		if err := s.DB("").C(db.materialsColName).Find(bson.M{"parent_id": bson.M{"$gt": 0}}).All(&withParent); err != nil {
+			return err
+		}
+		parents := materialParents(withParent)
+		var mIDs []uint
 		mIDMap := make(map[uint]Material)
 		for _, material := range m {
-			mIDs = append(mIDs, material.ID)
 			mIDMap[material.ID] = material
+			mIDs = append(mIDs, materialLineage(material.ID, parents)...)
 		}
+		codes := region.Codes()
 		collection := s.DB("").C(db.materialsToBinsColName)
-		var mIDsToBinIDs []struct {
-			MaterialID uint `bson:"material_id"`
-			BinID      uint `bson:"bin_id"`
-		}
-		if err := collection.Find(bson.M{"material_id": bson.M{"$in": mIDs}}).All(&mIDsToBinIDs); err != nil {
+		var rules []BinRule
+		if err := collection.Find(bson.M{"material_id": bson.M{"$in": mIDs}, "region": bson.M{"$in": mgoRegions(codes)}}).All(&rules); err != nil {
 			return err
 		}
+		mIDsToBinIDs := mostSpecificBins(rules, codes, at, parents)
 		var binIDs []uint
-		for _, mb := range mIDsToBinIDs {
-			binIDs = append(binIDs, mb.BinID)
+		for _, binID := range mIDsToBinIDs {
+			binIDs = append(binIDs, binID)
 		}
 		collection = s.DB("").C(db.binsColName)
 		var bins []Bin
@@ -170,23 +232,94 @@ func (db mgoPackagesDB) GetBins(m []Material) (map[Material]Bin, error) {
 			binMap[b.ID] = b
 		}
 
-		for _, mIDToBinID := range mIDsToBinIDs {
-			material := mIDMap[mIDToBinID.MaterialID]
-			r[material] = binMap[mIDToBinID.BinID]
+		for materialID, binID := range mIDsToBinIDs {
+			if material, ok := mIDMap[materialID]; ok {
+				r[material] = binMap[binID]
+			}
 		}
 
 		return nil
 	})
 }
 
+// mgoRegions returns the values of the region field of rules of codes, rules without region being the default ones
+func mgoRegions(codes []string) []interface{} {
+	regions := []interface{}{nil}
+	for _, code := range codes {
+		regions = append(regions, code)
+	}
+	return regions
+}
+
+func (db mgoPackagesDB) BinRules(r Region) ([]BinRule, error) {
+	var rules []BinRule
+	err := withMgoSession(db.session, func(s *mgo.Session) error {
+		collection := s.DB("").C(db.materialsToBinsColName)
+		return collection.Find(bson.M{"region": bson.M{"$in": mgoRegions(r.Codes())}}).All(&rules)
+	})
+	return rules, err
+}
+
+func (db mgoPackagesDB) AddBinRules(rules []BinRule) error {
+	docs := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		rule, err := normalizeBinRule(rule)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, rule)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return withMgoSession(db.session, func(s *mgo.Session) error {
+		return s.DB("").C(db.materialsToBinsColName).Insert(docs...)
+	})
+}
+
+// GetPreparations returns the preparation of each material from its most specific region, for the material or its ancestors.
+// Preparations without a region field are the default ones.
+func (db mgoPackagesDB) GetPreparations(m []Material, r Region) (map[uint]Preparation, error) {
+	out := make(map[uint]Preparation)
+	return out, withMgoSession(db.session, func(s *mgo.Session) error {
+		var withParent []Material
+		if err := s.DB("").C(db.materialsColName).Find(bson.M{"parent_id": bson.M{"$gt": 0}}).All(&withParent); err != nil {
+			return err
+		}
+		parents := materialParents(withParent)
+		var mIDs []uint
+		for _, material := range m {
+			mIDs = append(mIDs, materialLineage(material.ID, parents)...)
+		}
+		var preparations []Preparation
+		collection := s.DB("").C(db.preparationsColName)
+		if err := collection.Find(bson.M{"material_id": bson.M{"$in": mIDs}, "region": bson.M{"$in": mgoRegions(r.Codes())}}).All(&preparations); err != nil {
+			return err
+		}
+		best := mostSpecificPreparations(preparations, r.Codes(), parents)
+		for _, material := range m {
+			if p, ok := best[material.ID]; ok {
+				out[material.ID] = p
+			}
+		}
+		return nil
+	})
+}
+
 // ProductPackage links a Product and its packages
+// SuggestedMaterials are guessed from the packaging data of the Product when its package is unknown, for users to confirm them
 type ProductPackage struct {
-	Product   `json:",inline"`
-	Materials []Material `json:"materials"`
+	Product            `json:",inline"`
+	Materials          []Material   `json:"materials"`
+	SuggestedMaterials []Material   `json:"suggested_materials,omitempty"`
+	Barcode            *BarcodeInfo `json:"barcode,omitempty"` // Country and category of the EAN, from its GS1 prefix
 }
 
 func NewProductPackage(p Product, db PackagesDB) (ProductPackage, error) {
 	pp := ProductPackage{Product: p}
+	if info, err := DecodeBarcode(p.EAN); err == nil {
+		pp.Barcode = &info
+	}
 	pkg, err := db.Get(p.EAN)
 	if err != nil {
 		if err == errPackageNotFound {
@@ -199,17 +332,164 @@ func NewProductPackage(p Product, db PackagesDB) (ProductPackage, error) {
 	return pp, nil
 }
 
-func (pp ProductPackage) ThrowAway(db PackagesDB) (map[Material]Bin, error) {
-	return db.GetBins(pp.Materials)
+// MaterialTags maps packaging tags of websites (see PackagingData) to Material names, to suggest the materials of unknown packages.
+// Names are matched case-insensitively with the materials of the MaterialDB, tags of materials it does not have are ignored.
+// Tags are looked up as is, then without their language prefix (e.g. fr:carton as carton).
+// A part of a packaging is looked up as "shape/material", then as its material.
+var MaterialTags = map[string]string{
+	"carton":                 "Boîte carton",
+	"boite-en-carton":        "Boîte carton",
+	"en:cardboard":           "Boîte carton",
+	"en:cardboard-box":       "Boîte carton",
+	"papier":                 "Boîte carton",
+	"en:paper":               "Boîte carton",
+	"film-plastique":         "Film plastique",
+	"sachet-plastique":       "Film plastique",
+	"en:plastic-film":        "Film plastique",
+	"en:plastic-bag":         "Film plastique",
+	"en:film/en:plastic":     "Film plastique",
+	"en:bag/en:plastic":      "Film plastique",
+	"bouteille-plastique":    "Bouteille plastique",
+	"bouteille-en-plastique": "Bouteille plastique",
+	"en:plastic-bottle":      "Bouteille plastique",
+	"en:bottle/en:plastic":   "Bouteille plastique",
+	"bouteille-verre":        "Bouteille de verre",
+	"bouteille-en-verre":     "Bouteille de verre",
+	"verre":                  "Bouteille de verre",
+	"en:glass":               "Bouteille de verre",
+	"en:glass-bottle":        "Bouteille de verre",
+	"en:bottle/en:glass":     "Bouteille de verre",
+	"bouchon-plastique":      "Bouchon de bouteille en plastique",
+	"en:plastic-cap":         "Bouchon de bouteille en plastique",
+	"en:cap/en:plastic":      "Bouchon de bouteille en plastique",
+	"bouchon-metal":          "Bouchon de bouteille en métal",
+	"capsule":                "Bouchon de bouteille en métal",
+	"en:metal-cap":           "Bouchon de bouteille en métal",
+	"en:cap/en:metal":        "Bouchon de bouteille en métal",
+	"boite-plastique":        "Boîte plastique",
+	"barquette-plastique":    "Boîte plastique",
+	"en:plastic-box":         "Boîte plastique",
+	"en:box/en:plastic":      "Boîte plastique",
+	"en:tray/en:plastic":     "Boîte plastique",
+}
+
+// LoadMaterialTags reads a json object of tags to Material names, to replace MaterialTags
+func LoadMaterialTags(r io.Reader) (map[string]string, error) {
+	tags := make(map[string]string)
+	if err := json.NewDecoder(r).Decode(&tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// lookupMaterialTag returns the Material name of tag in MaterialTags
+func lookupMaterialTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if name, ok := MaterialTags[tag]; ok {
+		return name, true
+	}
+	if i := strings.Index(tag, ":"); i >= 0 && !strings.Contains(tag, "/") {
+		name, ok := MaterialTags[tag[i+1:]]
+		return name, ok
+	}
+	return "", false
 }
 
+// suggestMaterials returns the materials matching the packaging data, without duplicates
+func suggestMaterials(data *PackagingData, materials []Material) []Material {
+	if data == nil {
+		return nil
+	}
+	var names []string
+	for _, part := range data.Parts {
+		if name, ok := lookupMaterialTag(part.Shape + "/" + part.Material); ok {
+			names = append(names, name)
+		} else if name, ok := lookupMaterialTag(part.Material); ok {
+			names = append(names, name)
+		}
+	}
+	for _, tag := range data.Tags {
+		if name, ok := lookupMaterialTag(tag); ok {
+			names = append(names, name)
+		}
+	}
+
+	byName := make(map[string]Material, len(materials))
+	for _, m := range materials {
+		byName[strings.ToLower(m.Name)] = m
+	}
+	var suggested []Material
+	seen := make(map[uint]bool)
+	for _, name := range names {
+		if m, ok := byName[strings.ToLower(name)]; ok && !seen[m.ID] {
+			suggested = append(suggested, m)
+			seen[m.ID] = true
+		}
+	}
+	return suggested
+}
+
+// SuggestMaterials fills SuggestedMaterials from the packaging data of the Product, if its package is unknown
+func (pp *ProductPackage) SuggestMaterials(db MaterialDB) error {
+	if len(pp.Materials) > 0 || pp.Packaging == nil {
+		return nil
+	}
+	materials, err := db.GetAll()
+	if err != nil {
+		return err
+	}
+	pp.SuggestedMaterials = suggestMaterials(pp.Packaging, materials)
+	return nil
+}
+
+// ThrowAway returns the bin of each material of the package in region, at a date
+func (pp ProductPackage) ThrowAway(db PackagesDB, r Region, at time.Time) (map[Material]Bin, error) {
+	return db.GetBins(pp.Materials, r, at)
+}
+
+// BinMaterials is a bin with the materials of a package to throw away in it
+type BinMaterials struct {
+	Bin       `json:",inline"`
+	Materials []Material `json:"materials"`
+}
+
+// GroupByBin returns the bins of throwAway sorted by ID, with their materials sorted by name
+func GroupByBin(throwAway map[Material]Bin) []BinMaterials {
+	byID := make(map[uint]*BinMaterials)
+	var bins []*BinMaterials
+	for m, b := range throwAway {
+		bm, ok := byID[b.ID]
+		if !ok {
+			bm = &BinMaterials{Bin: b}
+			byID[b.ID] = bm
+			bins = append(bins, bm)
+		}
+		bm.Materials = append(bm.Materials, m)
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i].ID < bins[j].ID })
+	out := make([]BinMaterials, len(bins))
+	for i, bm := range bins {
+		sort.Slice(bm.Materials, func(i, j int) bool { return bm.Materials[i].Name < bm.Materials[j].Name })
+		out[i] = *bm
+	}
+	return out
+}
+
+// throwAwaypackage is the json of a ProductPackage and where to throw it away:
+// ThrowAway maps material names to bin names, Bins details each bin and Plan how to throw away each material
 type throwAwaypackage struct {
-	Product   ProductPackage    `json:"product"`
-	ThrowAway map[string]string `json:"throwAway"`
+	Product   ProductPackage     `json:"product"`
+	ThrowAway map[string]string  `json:"throwAway"`
+	Bins      []BinMaterials     `json:"bins,omitempty"`
+	Plan      []MaterialDisposal `json:"plan,omitempty"`
 }
 
-func (pp ProductPackage) ThrowAwayJSON(db PackagesDB) ([]byte, error) {
-	throwAway, err := pp.ThrowAway(db)
+func (pp ProductPackage) ThrowAwayJSON(db PackagesDB, r Region, at time.Time) ([]byte, error) {
+	throwAway, err := pp.ThrowAway(db, r, at)
+	if err != nil {
+		return nil, err
+	}
+	preparations, err := db.GetPreparations(pp.Materials, r)
 	if err != nil {
 		return nil, err
 	}
@@ -217,5 +497,5 @@ func (pp ProductPackage) ThrowAwayJSON(db PackagesDB) ([]byte, error) {
 	for k, v := range throwAway {
 		out[k.Name] = v.Name
 	}
-	return json.Marshal(throwAwaypackage{pp, out})
+	return json.Marshal(throwAwaypackage{pp, out, GroupByBin(throwAway), DisposalPlan(pp.Materials, throwAway, preparations)})
 }
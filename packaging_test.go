@@ -3,9 +3,12 @@ package recycleme
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"gopkg.in/mgo.v2"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,18 +16,38 @@ import (
 var binsJSON = `[
     {
       "id": 1,
-      "name": "Bac à couvercle vert"
+      "name": "Bac à couvercle vert",
+      "color": "#2e7d32",
+      "instructions": "dans un sac fermé",
+      "collection_type": "kerbside"
     },
     {
       "id": 2,
-      "name": "Bac à couvercle jaune"
+      "name": "Bac à couvercle jaune",
+      "color": "#f7d117",
+      "icon_url": "/static/img/bac-jaune.svg",
+      "instructions": "bien vidés, inutile de les laver, en vrac et sans les imbriquer",
+      "collection_type": "kerbside"
     },
     {
       "id": 3,
       "name": "Bac à couvercle blanc"
+    },
+    {
+      "id": 4,
+      "name": "Bac à couvercle marron"
     }
 ]`
 
+// regionalBinsJSON are bin rules overriding the default ones (from materialsJSON) in a department and in one of its communes,
+// the department sending all plastics to the yellow bin
+var regionalBinsJSON = `[
+    {"region": "FR-69", "material_id": 2, "bin_id": 2},
+    {"region": "FR-69", "material_id": 10, "bin_id": 2},
+    {"region": "FR-69", "material_id": 5, "bin_id": 4},
+    {"region": "FR-69001", "material_id": 5, "bin_id": 1}
+]`
+
 var materialsJSON = `[
     {
       "id": 1,
@@ -70,9 +93,39 @@ var materialsJSON = `[
       "id": 9,
       "name": "Boîte plastique",
       "bin_id": 1
+    },
+    {
+      "id": 10,
+      "name": "Plastique",
+      "bin_id": 1
+    },
+    {
+      "id": 11,
+      "name": "PET",
+      "parent_id": 10,
+      "bin_id": 2
+    },
+    {
+      "id": 12,
+      "name": "Barquette PET",
+      "parent_id": 11
+    },
+    {
+      "id": 13,
+      "name": "Pot de yaourt",
+      "parent_id": 10
     }
 ]`
 
+// preparationsJSON are default preparations of materials, and the ones of a department where bottle caps stay on bottles.
+// The one of PET is inherited by PET trays.
+var preparationsJSON = `[
+    {"material_id": 1, "region": "", "steps": ["vider la boîte", "aplatir la boîte"], "warnings": ["ne pas imbriquer les cartons"]},
+    {"material_id": 3, "region": "", "steps": ["vider la bouteille", "retirer le bouchon"]},
+    {"material_id": 3, "region": "FR-69", "steps": ["vider la bouteille", "laisser le bouchon"], "warnings": ["ne pas écraser la bouteille"]},
+    {"material_id": 11, "region": "", "steps": ["vider l'emballage"]}
+]`
+
 var packagesJSON = `[
     {
       "ean": "7613034383808",
@@ -154,6 +207,9 @@ func createMaterials(db *mgoPackagesDB) error {
 			if err := materialsCols.Insert(m.Material); err != nil {
 				return err
 			}
+			if m.BinID == 0 {
+				continue
+			}
 			v := struct {
 				MaterialdID uint `bson:"material_id"`
 				BinID       uint `bson:"bin_id"`
@@ -163,6 +219,30 @@ func createMaterials(db *mgoPackagesDB) error {
 			}
 		}
 
+		var rules []BinRule
+		if err := json.Unmarshal([]byte(regionalBinsJSON), &rules); err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if err := materialsToBinsCols.Insert(rule); err != nil {
+				return err
+			}
+		}
+
+		preparationsCol := s.DB("").C(db.preparationsColName)
+		if err := preparationsCol.DropCollection(); err != nil && err.Error() != "ns not found" {
+			return err
+		}
+		var preparations []Preparation
+		if err := json.Unmarshal([]byte(preparationsJSON), &preparations); err != nil {
+			return err
+		}
+		for _, p := range preparations {
+			if err := preparationsCol.Insert(p); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
@@ -230,7 +310,7 @@ func TestPackage(t *testing.T) {
 		}
 	}
 
-	materialsToBins, err := packageDB.GetBins(r.Materials)
+	materialsToBins, err := packageDB.GetBins(r.Materials, Region{}, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -244,6 +324,78 @@ func TestPackage(t *testing.T) {
 	}
 }
 
+// testRegionalBins checks that rules of regionalBinsJSON override the default ones, the most specific region first
+func testRegionalBins(t *testing.T, db PackagesDB) {
+	materials := []Material{{ID: 1, Name: "Boîte carton"}, {ID: 2, Name: "Film plastique"}, {ID: 5, Name: "Nourriture"}}
+	for region, binNames := range map[string][]string{
+		"":         {"Bac à couvercle jaune", "Bac à couvercle vert", "Bac à couvercle vert"},
+		"FR":       {"Bac à couvercle jaune", "Bac à couvercle vert", "Bac à couvercle vert"},
+		"FR-69003": {"Bac à couvercle jaune", "Bac à couvercle jaune", "Bac à couvercle marron"},
+		"FR-69":    {"Bac à couvercle jaune", "Bac à couvercle jaune", "Bac à couvercle marron"},
+		"FR-69001": {"Bac à couvercle jaune", "Bac à couvercle jaune", "Bac à couvercle vert"},
+	} {
+		r, err := ParseRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bins, err := db.GetBins(materials, r, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, m := range materials {
+			if bins[m].Name != binNames[i] {
+				t.Errorf("in region %q, material %v belong to %v, not %v", region, m.Name, binNames[i], bins[m].Name)
+			}
+		}
+	}
+}
+
+func TestRegionalBins(t *testing.T) {
+	testRegionalBins(t, packageDB)
+}
+
+// testPreparations checks that preparations of preparationsJSON are localized by region, and inherited through the taxonomy
+func testPreparations(t *testing.T, db PackagesDB) {
+	materials := []Material{{ID: 1, Name: "Boîte carton"}, {ID: 2, Name: "Film plastique"}, {ID: 3, Name: "Bouteille plastique"},
+		{ID: 12, Name: "Barquette PET", ParentID: 11}, {ID: 13, Name: "Pot de yaourt", ParentID: 10}}
+	for region, expected := range map[string]map[uint][]string{
+		"":         {1: {"vider la boîte", "aplatir la boîte"}, 3: {"vider la bouteille", "retirer le bouchon"}, 12: {"vider l'emballage"}},
+		"FR-75011": {1: {"vider la boîte", "aplatir la boîte"}, 3: {"vider la bouteille", "retirer le bouchon"}, 12: {"vider l'emballage"}},
+		"FR-69001": {1: {"vider la boîte", "aplatir la boîte"}, 3: {"vider la bouteille", "laisser le bouchon"}, 12: {"vider l'emballage"}},
+	} {
+		r, err := ParseRegion(region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		preparations, err := db.GetPreparations(materials, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(preparations) != len(expected) {
+			t.Errorf("in region %q, expected preparations of %v, got %v", region, expected, preparations)
+		}
+		for id, steps := range expected {
+			if !reflect.DeepEqual(preparations[id].Steps, steps) {
+				t.Errorf("in region %q, expected steps %v for material %v, got %v", region, steps, id, preparations[id].Steps)
+			}
+		}
+	}
+}
+
+func TestPreparations(t *testing.T) {
+	testPreparations(t, packageDB)
+}
+
+func TestDisposalPlan(t *testing.T) {
+	green := Bin{ID: 1, Name: "Bac à couvercle vert"}
+	m1, m2 := Material{ID: 1, Name: "Boîte carton"}, Material{ID: 9, Name: "Boîte plastique"}
+	plan := DisposalPlan([]Material{m2, m1}, map[Material]Bin{m1: green}, map[uint]Preparation{1: {MaterialID: 1, Steps: []string{"aplatir la boîte"}}})
+	expected := []MaterialDisposal{{Material: m2}, {Material: m1, Steps: []string{"aplatir la boîte"}, Bin: &green}}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected %+v, got %+v", expected, plan)
+	}
+}
+
 func TestProductPackage(t *testing.T) {
 	product := Product{EAN: "7613034383808", Name: "Four à Pierre Royale", URL: "http://fr.openfoodfacts.org/api/v0/produit/7613034383808.json", ImageURL: "http://static.openfoodfacts.org/images/products/761/303/438/3808/front.8.400.jpg"}
 	pp, err := NewProductPackage(product, packageDB)
@@ -269,7 +421,7 @@ func TestProductPackage(t *testing.T) {
 	}
 
 	binNames := map[string]string{"Boîte carton": "Bac à couvercle jaune", "Film plastique": "Bac à couvercle vert", "Nourriture": "Bac à couvercle vert"}
-	materialToBins, err := pp.ThrowAway(packageDB)
+	materialToBins, err := pp.ThrowAway(packageDB, Region{}, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -290,17 +442,26 @@ func TestThrowAwayJSON(t *testing.T) {
 	m1 := Material{ID: 1, Name: "Boîte carton"}
 	m2 := Material{ID: 2, Name: "Film plastique"}
 	m3 := Material{ID: 5, Name: "Nourriture"}
+	green := Bin{ID: 1, Name: "Bac à couvercle vert", Color: "#2e7d32", Instructions: "dans un sac fermé", CollectionType: CollectionKerbside}
+	yellow := Bin{ID: 2, Name: "Bac à couvercle jaune", Color: "#f7d117", IconURL: "/static/img/bac-jaune.svg", Instructions: "bien vidés, inutile de les laver, en vrac et sans les imbriquer", CollectionType: CollectionKerbside}
 	expected, err := json.Marshal(throwAwaypackage{
 		Product: ProductPackage{
 			Product:   product,
-			Materials: []Material{m1, m2, m3}},
+			Materials: []Material{m1, m2, m3},
+			Barcode:   &BarcodeInfo{GTIN: "7613034383808", Prefix: "761", Country: "Switzerland and Liechtenstein", Category: CategoryProduct}},
 		ThrowAway: map[string]string{m1.Name: "Bac à couvercle jaune", m2.Name: "Bac à couvercle vert", m3.Name: "Bac à couvercle vert"},
+		Bins:      []BinMaterials{{Bin: green, Materials: []Material{m2, m3}}, {Bin: yellow, Materials: []Material{m1}}},
+		Plan: []MaterialDisposal{
+			{Material: m1, Steps: []string{"vider la boîte", "aplatir la boîte"}, Warnings: []string{"ne pas imbriquer les cartons"}, Bin: &yellow},
+			{Material: m2, Bin: &green},
+			{Material: m3, Bin: &green},
+		},
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	out, err := pkg.ThrowAwayJSON(packageDB)
+	out, err := pkg.ThrowAwayJSON(packageDB, Region{}, time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -309,6 +470,77 @@ func TestThrowAwayJSON(t *testing.T) {
 	}
 }
 
+func TestGroupByBin(t *testing.T) {
+	green, yellow := Bin{ID: 1, Name: "Bac à couvercle vert"}, Bin{ID: 2, Name: "Bac à couvercle jaune"}
+	m1, m2, m3 := Material{ID: 1, Name: "Boîte carton"}, Material{ID: 2, Name: "Film plastique"}, Material{ID: 5, Name: "Nourriture"}
+	bins := GroupByBin(map[Material]Bin{m3: green, m1: yellow, m2: green})
+	expected := []BinMaterials{{Bin: green, Materials: []Material{m2, m3}}, {Bin: yellow, Materials: []Material{m1}}}
+	if !reflect.DeepEqual(bins, expected) {
+		t.Errorf("expected %v, got %v", expected, bins)
+	}
+	if bins := GroupByBin(nil); len(bins) != 0 {
+		t.Errorf("no bins expected, got %v", bins)
+	}
+}
+
+func TestSuggestMaterials(t *testing.T) {
+	materials, err := packageDB.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &PackagingData{
+		Tags: []string{"fr:carton", "en:unknown", "en:glass"},
+		Parts: []PackagingPart{
+			{Shape: "en:bottle", Material: "en:plastic"},
+			{Shape: "en:unknown", Material: "en:glass"},
+			{Shape: "en:bottle", Material: "en:unknown"},
+		},
+	}
+	suggested := suggestMaterials(data, materials)
+	if fmt.Sprint(suggested) != fmt.Sprint([]Material{{ID: 3, Name: "Bouteille plastique"}, {ID: 4, Name: "Bouteille de verre"}, {ID: 1, Name: "Boîte carton"}}) {
+		t.Errorf("invalid suggested materials: %v", suggested)
+	}
+
+	pkg, err := NewProductPackage(Product{EAN: "7613034383808", Packaging: data}, packageDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.SuggestMaterials(packageDB); err != nil || pkg.SuggestedMaterials != nil {
+		t.Errorf("known packages should not have suggestions: %v, %v", pkg.SuggestedMaterials, err)
+	}
+
+	// books are suggested to be paper, from the default packaging of their source
+	book, err := IsbnSearchFetcher.ParseBody([]byte(`<div class="bookinfo"><h1>A book</h1></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.EAN = "9780306406157"
+	pkg, err = NewProductPackage(book, packageDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.SuggestMaterials(packageDB); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(pkg.SuggestedMaterials) != fmt.Sprint([]Material{{ID: 1, Name: "Boîte carton"}}) {
+		t.Errorf("books should be suggested to be paper: %v", pkg.SuggestedMaterials)
+	}
+
+	// materials are matched by name, whatever their ids in the MaterialDB
+	renumbered := []Material{{ID: 42, Name: "bouteille plastique"}, {ID: 43, Name: "Boîte carton"}}
+	if suggested := suggestMaterials(data, renumbered); fmt.Sprint(suggested) != fmt.Sprint([]Material{renumbered[0], renumbered[1]}) {
+		t.Errorf("invalid suggested materials by name: %v", suggested)
+	}
+
+	defer func(tags map[string]string) { MaterialTags = tags }(MaterialTags)
+	MaterialTags, err = LoadMaterialTags(strings.NewReader(`{"en:plastic": "Film plastique"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggested := suggestMaterials(data, materials); fmt.Sprint(suggested) != fmt.Sprint([]Material{{ID: 2, Name: "Film plastique"}}) {
+		t.Errorf("invalid suggested materials with custom tags: %v", suggested)
+	}
+}
+
 func TestPackageDBSet(t *testing.T) {
 	if err := packageDB.Set("invalid", nil); err == nil {
 		t.Error("ean should have been checked")
@@ -345,39 +577,103 @@ func TestPackageDBSet(t *testing.T) {
 		}
 		seenMaterials[m.ID] = struct{}{}
 	}
+
+	// packages are stored by canonical GTIN, whatever the barcode used
+	if err := packageDB.Set("012345678905", []Material{m1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"012345678905", "0012345678905"} {
+		if pkg, err := packageDB.Get(code); err != nil {
+			t.Error(err)
+		} else if pkg.EAN != "0012345678905" || len(pkg.Materials) != 1 {
+			t.Errorf("unexpected package for %v: %v", code, pkg)
+		}
+	}
 }
 
-var packageDB *mgoPackagesDB
-var blacklistDB *mgoBlacklistDB
-var localProductDB *mgoLocalProductDB
+// testPackagesDB is satisfied by all packages db implementations, either mongodb or in memory
+type testPackagesDB interface {
+	PackagesDB
+	MaterialDB
+	BinRulesDB
+}
 
-func TestMain(m *testing.M) {
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+var packageDB testPackagesDB
+var blacklistDB BlacklistDB
+var localProductDB Fetcher
 
-	mongoSession, err := NewMgoDB(os.Getenv("RECYCLEME_MONGO_TEST_URI"))
-	if err != nil {
-		logger.Fatal(err)
+func setupMgoDB(mongoSession *mgo.Session) error {
+	mgoPackageDB := NewMgoPackageDB(mongoSession, "test_")
+	if err := createBins(mgoPackageDB); err != nil {
+		return err
 	}
-	packageDB = NewMgoPackageDB(mongoSession, "test_")
 
-	if err = createBins(packageDB); err != nil {
-		logger.Fatal(err)
+	if err := createMaterials(mgoPackageDB); err != nil {
+		return err
 	}
 
-	if err = createMaterials(packageDB); err != nil {
-		logger.Fatal(err)
+	if err := createPackages(mgoPackageDB); err != nil {
+		return err
 	}
 
-	if err = createPackages(packageDB); err != nil {
-		logger.Fatal(err)
+	mgoLocalProductDB := NewMgoLocalProductDB(mongoSession, "test_")
+	if err := createLocalProducts(mgoLocalProductDB); err != nil {
+		return err
 	}
 
-	localProductDB = NewMgoLocalProductDB(mongoSession, "test_")
-	if err = createLocalProducts(localProductDB); err != nil {
+	packageDB = mgoPackageDB
+	localProductDB = mgoLocalProductDB
+	blacklistDB = NewMgoBlacklistDB(mongoSession, "test_")
+	return nil
+}
+
+func setupMemoryDB() error {
+	db := NewMemoryDB()
+	if err := db.LoadBins(strings.NewReader(binsJSON)); err != nil {
+		return err
+	}
+	if err := db.LoadMaterials(strings.NewReader(materialsJSON)); err != nil {
+		return err
+	}
+	if err := db.LoadMaterialsToBins(strings.NewReader(regionalBinsJSON)); err != nil {
+		return err
+	}
+	if err := db.LoadPreparations(strings.NewReader(preparationsJSON)); err != nil {
+		return err
+	}
+	if err := db.LoadPackages(strings.NewReader(packagesJSON)); err != nil {
+		return err
+	}
+	memoryLocalProductDB := NewMemoryLocalProductDB(db)
+	memoryLocalProductDB.AddProduct(Product{EAN: "ean_test", Name: "name_test", WebsiteName: "website_name_test"})
+
+	packageDB = NewMemoryPackageDB(db)
+	localProductDB = memoryLocalProductDB
+	blacklistDB = NewMemoryBlacklistDB(db)
+	return nil
+}
+
+// TestMain runs tests against mongodb if RECYCLEME_MONGO_TEST_URI is set, in memory otherwise
+func TestMain(m *testing.M) {
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+
+	mongoURI := os.Getenv("RECYCLEME_MONGO_TEST_URI")
+	if mongoURI == "" {
+		logger.Println("RECYCLEME_MONGO_TEST_URI not set, running tests with in memory db")
+		if err := setupMemoryDB(); err != nil {
+			logger.Fatal(err)
+		}
+		os.Exit(m.Run())
+	}
+
+	mongoSession, err := NewMgoDB(mongoURI)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if err = setupMgoDB(mongoSession); err != nil {
 		logger.Fatal(err)
 	}
 
-	blacklistDB = NewMgoBlacklistDB(mongoSession, "test_")
 	ex := m.Run()
 	mongoSession.Close()
 
@@ -0,0 +1,296 @@
+package recycleme
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserAgent sent to websites, so they know who is scraping them and how to reach us
+var UserAgent = "recycleme/1.0 (+http://www.howtorecycle.me)"
+
+// RespectRobotsTxt makes FetchableURL check robots.txt rules of websites before scraping them
+var RespectRobotsTxt = false
+
+// RateLimit is a token bucket: Burst requests can be sent at once, then PerSecond requests per second
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// DefaultRateLimit is used for hosts without a specific rate limit
+var DefaultRateLimit = RateLimit{PerSecond: 1, Burst: 5}
+
+// MaxRateLimitWait is how long a request may wait for its turn before failing with errRateLimited
+var MaxRateLimitWait = 2 * time.Second
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+// If the wait would be longer than maxWait, no token is taken and false is returned.
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.PerSecond
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if b.limit.PerSecond <= 0 {
+		return 0, false
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.PerSecond * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// hostRateLimiter holds a token bucket per host
+type hostRateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*tokenBucket
+}
+
+var rateLimiter = &hostRateLimiter{limits: make(map[string]RateLimit), buckets: make(map[string]*tokenBucket)}
+
+// SetHostRateLimit overrides DefaultRateLimit for host (as in url.URL.Host, e.g. www.upcitemdb.com)
+func SetHostRateLimit(host string, limit RateLimit) {
+	rateLimiter.mu.Lock()
+	defer rateLimiter.mu.Unlock()
+	rateLimiter.limits[host] = limit
+	delete(rateLimiter.buckets, host)
+}
+
+func (l *hostRateLimiter) bucket(host string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[host]
+	if !ok {
+		limit, ok := l.limits[host]
+		if !ok {
+			limit = DefaultRateLimit
+		}
+		b = newTokenBucket(limit, time.Now())
+		l.buckets[host] = b
+	}
+	return b
+}
+
+// wait blocks until a request can be sent to host, or returns errRateLimited if it would take longer than MaxRateLimitWait
+func (l *hostRateLimiter) wait(ctx context.Context, host string) error {
+	wait, ok := l.bucket(host).reserve(time.Now(), MaxRateLimitWait)
+	if !ok {
+		return errRateLimited
+	}
+	if wait == 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// robotsRules are the Allow and Disallow rules of a robots.txt group
+type robotsRules struct {
+	allow, disallow []string
+}
+
+// allowed applies the longest matching rule, Allow wins on equality
+func (r robotsRules) allowed(path string) bool {
+	longestAllow, longestDisallow := -1, -1
+	for _, a := range r.allow {
+		if strings.HasPrefix(path, a) && len(a) > longestAllow {
+			longestAllow = len(a)
+		}
+	}
+	for _, d := range r.disallow {
+		if strings.HasPrefix(path, d) && len(d) > longestDisallow {
+			longestDisallow = len(d)
+		}
+	}
+	return longestAllow >= longestDisallow
+}
+
+// parseRobotsTxt returns the rules of the group matching agent, or of the "*" group if there is none.
+// A group matches if its product token (the name before "/") is the one of agent, e.g. recycleme for recycleme/1.0 (+http://www.howtorecycle.me)
+func parseRobotsTxt(b []byte, agent string) robotsRules {
+	agent = productToken(strings.ToLower(agent))
+	groups := make(map[string]*robotsRules)
+	var current []string
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		switch key {
+		case "user-agent":
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			ua := strings.ToLower(value)
+			current = append(current, ua)
+			if _, ok := groups[ua]; !ok {
+				groups[ua] = &robotsRules{}
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			value = strings.TrimSuffix(value, "*")
+			for _, ua := range current {
+				if key == "allow" {
+					groups[ua].allow = append(groups[ua].allow, value)
+				} else {
+					groups[ua].disallow = append(groups[ua].disallow, value)
+				}
+			}
+		}
+	}
+	// the most specific group wins, e.g. recycleme/1.0 over recycleme
+	best := ""
+	for ua := range groups {
+		if ua != "*" && productToken(ua) == agent && (len(ua) > len(best) || (len(ua) == len(best) && ua < best)) {
+			best = ua
+		}
+	}
+	if best != "" {
+		return *groups[best]
+	}
+	if rules, ok := groups["*"]; ok {
+		return *rules
+	}
+	return robotsRules{}
+}
+
+// productToken returns the name of a user agent, without its version and comment
+func productToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		return agent[:i]
+	}
+	return agent
+}
+
+// RobotsTxtTTL is how long robots.txt rules are cached
+var RobotsTxtTTL = 24 * time.Hour
+
+// RobotsTxtErrorTTL is how long everything is allowed on a website whose robots.txt could not be fetched
+// (network error, timeout, 5xx) before trying again
+var RobotsTxtErrorTTL = time.Minute
+
+// RobotsTxtTimeout is how long fetching a robots.txt may take, whatever the lookup which needed it
+var RobotsTxtTimeout = 10 * time.Second
+
+type cachedRobotsRules struct {
+	rules     robotsRules
+	expiresAt time.Time
+}
+
+type robotsCache struct {
+	mu    sync.Mutex
+	rules map[string]cachedRobotsRules
+	// flights fetches the robots.txt of a website once for all concurrent lookups
+	flights *flightGroup
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{rules: make(map[string]cachedRobotsRules), flights: &flightGroup{flights: make(map[string]*flight), detached: true}}
+}
+
+var robots = newRobotsCache()
+
+// allowed checks if UserAgent may fetch rawURL.
+// robots.txt is fetched once for concurrent lookups of a website, in the background with its own timeout,
+// so a cancelled lookup does not cache a failure.
+// If it cannot be fetched, everything is allowed for RobotsTxtErrorTTL, if it is forbidden (401, 403), nothing is.
+func (c *robotsCache) allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	key := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	cached, ok := c.rules[key]
+	c.mu.Unlock()
+	if !ok || time.Now().After(cached.expiresAt) {
+		v, err := c.flights.run(ctx, key, func(context.Context) (interface{}, error) {
+			fetchCtx, cancel := context.WithTimeout(context.Background(), RobotsTxtTimeout)
+			defer cancel()
+			rules, ttl := fetchRobotsTxt(fetchCtx, key+"/robots.txt")
+			cached := cachedRobotsRules{rules: rules, expiresAt: time.Now().Add(ttl)}
+			c.mu.Lock()
+			c.rules[key] = cached
+			c.mu.Unlock()
+			return cached, nil
+		})
+		if err != nil {
+			return false, err
+		}
+		cached = v.(cachedRobotsRules)
+	}
+	return cached.rules.allowed(u.RequestURI()), nil
+}
+
+// fetchRobotsTxt returns the rules of robotsURL for UserAgent and how long to cache them.
+// It is sent with sendRequest, as the other requests to the website.
+func fetchRobotsTxt(ctx context.Context, robotsURL string) (robotsRules, time.Duration) {
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return robotsRules{}, RobotsTxtErrorTTL
+	}
+	resp, err := sendRequest(ctx, req)
+	if err != nil {
+		return robotsRules{}, RobotsTxtErrorTTL
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return robotsRules{}, RobotsTxtErrorTTL
+		}
+		return parseRobotsTxt(b, UserAgent), RobotsTxtTTL
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return robotsRules{disallow: []string{"/"}}, RobotsTxtTTL
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		// no robots.txt
+		return robotsRules{}, RobotsTxtTTL
+	}
+	return robotsRules{}, RobotsTxtErrorTTL
+}
@@ -0,0 +1,243 @@
+package recycleme
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimit{PerSecond: 2, Burst: 2}, now)
+	for i := 0; i < 2; i++ {
+		if wait, ok := b.reserve(now, 0); !ok || wait != 0 {
+			t.Fatalf("burst should be available, got %v, %v", wait, ok)
+		}
+	}
+	if _, ok := b.reserve(now, 0); ok {
+		t.Fatal("bucket should be empty")
+	}
+	if wait, ok := b.reserve(now, time.Second); !ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %v, %v", wait, ok)
+	}
+	// the token has been reserved, next one is in 1s
+	if wait, ok := b.reserve(now, 2*time.Second); !ok || wait != time.Second {
+		t.Fatalf("expected to wait 1s, got %v, %v", wait, ok)
+	}
+	now = now.Add(10 * time.Second)
+	if wait, ok := b.reserve(now, 0); !ok || wait != 0 {
+		t.Fatalf("bucket should be refilled, got %v, %v", wait, ok)
+	}
+}
+
+func TestParseRobotsTxt(t *testing.T) {
+	robotsTxt := []byte(`# comment
+User-agent: badbot
+Disallow: /
+
+User-agent: recycleme
+User-agent: otherbot
+Disallow: /private
+Allow: /private/public
+
+User-agent: *
+Disallow: /search # no search for everyone
+Disallow:
+`)
+	rules := parseRobotsTxt(robotsTxt, UserAgent)
+	for path, expected := range map[string]bool{
+		"/":                    true,
+		"/search?q=1":          true,
+		"/private/page":        false,
+		"/private/public/page": true,
+	} {
+		if rules.allowed(path) != expected {
+			t.Errorf("%v allowed should be %v for recycleme", path, expected)
+		}
+	}
+
+	rules = parseRobotsTxt(robotsTxt, "somebot")
+	if rules.allowed("/search?q=1") || !rules.allowed("/private") {
+		t.Errorf("invalid rules for *: %v", rules)
+	}
+	if !parseRobotsTxt([]byte(""), UserAgent).allowed("/") {
+		t.Error("empty robots.txt should allow everything")
+	}
+
+	// the most specific group wins, whatever the order of the groups
+	robotsTxt = []byte("User-agent: recycle\nDisallow: /a\n\nUser-agent: recycleme\nDisallow: /b\n\nUser-agent: recycleme/1.0\nDisallow: /c\n")
+	for i := 0; i < 20; i++ {
+		if rules := parseRobotsTxt(robotsTxt, UserAgent); !rules.allowed("/a") || !rules.allowed("/b") || rules.allowed("/c") {
+			t.Fatalf("the recycleme/1.0 group should be used, got %v", rules)
+		}
+	}
+
+	// groups match the product token of the user agent, not any part of it
+	robotsTxt = []byte("User-agent: me\nDisallow: /\n\nUser-agent: howtorecycle\nDisallow: /\n")
+	if rules := parseRobotsTxt(robotsTxt, UserAgent); !rules.allowed("/") {
+		t.Errorf("only the recycleme token should match, got %v", rules)
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	robotsRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		robotsRequests++
+		w.WriteHeader(status)
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	defer func(errorTTL time.Duration) {
+		RobotsTxtErrorTTL = errorTTL
+		SetHostRateLimit(host, DefaultRateLimit)
+	}(RobotsTxtErrorTTL)
+	setStatus := func(s int) {
+		mu.Lock()
+		defer mu.Unlock()
+		status = s
+	}
+	c := newRobotsCache()
+
+	// failures are only cached for RobotsTxtErrorTTL
+	if ok, err := c.allowed(context.Background(), ts.URL+"/private/1"); err != nil || !ok {
+		t.Errorf("everything should be allowed when robots.txt is unavailable, got %v (%v)", ok, err)
+	}
+	setStatus(http.StatusOK)
+	if ok, _ := c.allowed(context.Background(), ts.URL+"/private/1"); !ok || robotsRequests != 1 {
+		t.Errorf("failures should be cached for a while, got %v after %v requests", ok, robotsRequests)
+	}
+	RobotsTxtErrorTTL = 0
+	c.rules = make(map[string]cachedRobotsRules)
+	setStatus(http.StatusServiceUnavailable)
+	c.allowed(context.Background(), ts.URL+"/private/1")
+	setStatus(http.StatusOK)
+	if ok, _ := c.allowed(context.Background(), ts.URL+"/private/1"); ok {
+		t.Error("robots.txt should be fetched again after a failure")
+	}
+
+	// forbidden robots.txt disallows everything
+	c.rules = make(map[string]cachedRobotsRules)
+	setStatus(http.StatusForbidden)
+	if ok, _ := c.allowed(context.Background(), ts.URL+"/public"); ok {
+		t.Error("a forbidden robots.txt should disallow everything")
+	}
+
+	// a cancelled lookup does not cache anything wrong
+	c.rules = make(map[string]cachedRobotsRules)
+	setStatus(http.StatusOK)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.allowed(ctx, ts.URL+"/private/1"); err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+	if ok, _ := c.allowed(context.Background(), ts.URL+"/private/1"); ok {
+		t.Error("robots.txt rules should apply after a cancelled lookup")
+	}
+
+	// concurrent lookups share the same robots.txt request
+	c.rules = make(map[string]cachedRobotsRules)
+	mu.Lock()
+	robotsRequests = 0
+	mu.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.allowed(context.Background(), ts.URL+"/public")
+		}()
+	}
+	wg.Wait()
+	if robotsRequests != 1 {
+		t.Errorf("robots.txt should be fetched once, got %v requests", robotsRequests)
+	}
+
+	// robots.txt requests take their turn in the rate limit of the host
+	c.rules = make(map[string]cachedRobotsRules)
+	SetHostRateLimit(host, RateLimit{PerSecond: 0.001, Burst: 1})
+	c.allowed(context.Background(), ts.URL+"/public")
+	if _, ok := rateLimiter.bucket(host).reserve(time.Now(), time.Millisecond); ok {
+		t.Error("robots.txt request should have used the rate limit of the host")
+	}
+}
+
+func TestPoliteFetchableURL(t *testing.T) {
+	var mu sync.Mutex
+	var userAgents []string
+	robotsRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			robotsRequests++
+		}
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case strings.HasPrefix(r.URL.Path, "/busy"):
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, "<html><body><p class=\"detailtitle\">Title <b>product</b></p></body></html>")
+		}
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	defer func(maxWait time.Duration, respectRobotsTxt bool) {
+		MaxRateLimitWait = maxWait
+		RespectRobotsTxt = respectRobotsTxt
+		SetHostRateLimit(host, DefaultRateLimit)
+	}(MaxRateLimitWait, RespectRobotsTxt)
+
+	f, err := NewFetchableURL(ts.URL+"/upc/%s", "test", UpcItemDbFetcher.HTMLParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Fetch(context.Background(), "5029053038896", blacklistDB); err != nil {
+		t.Fatal(err)
+	}
+	if len(userAgents) != 1 || userAgents[0] != UserAgent {
+		t.Errorf("expected user agent %v, got %v", UserAgent, userAgents)
+	}
+
+	busy, _ := NewFetchableURL(ts.URL+"/busy/%s", "test", UpcItemDbFetcher.HTMLParser)
+	if _, err := busy.Fetch(context.Background(), "5029053038896", blacklistDB); err == nil || err.(*productError).err != errThrottled {
+		t.Errorf("expected throttled error, got %v", err)
+	}
+
+	RespectRobotsTxt = true
+	private, _ := NewFetchableURL(ts.URL+"/private/%s", "test", UpcItemDbFetcher.HTMLParser)
+	if _, err := private.Fetch(context.Background(), "5029053038896", blacklistDB); err == nil || err.(*productError).err != errDisallowedByRobots {
+		t.Errorf("expected robots.txt error, got %v", err)
+	}
+	if _, err := f.Fetch(context.Background(), "5029053038896", blacklistDB); err != nil {
+		t.Error(err)
+	}
+	if robotsRequests != 1 {
+		t.Errorf("robots.txt should be fetched once, got %v requests", robotsRequests)
+	}
+
+	SetHostRateLimit(host, RateLimit{PerSecond: 0.001, Burst: 1})
+	MaxRateLimitWait = 10 * time.Millisecond
+	if _, err := f.Fetch(context.Background(), "5029053038896", blacklistDB); err != nil {
+		t.Error(err)
+	}
+	_, err = f.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if !isRateLimited(err) {
+		t.Errorf("expected rate limited error, got %v", err)
+	}
+	errs := fetchErrors{err, newProductError("5029053038896", ts.URL, errNotFound)}
+	if isNotFound(errs) || !strings.Contains(errs.Error(), "1 sources rate limited") {
+		t.Errorf("rate limits should be reported distinctly from not found: %v", errs)
+	}
+}
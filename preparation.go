@@ -0,0 +1,94 @@
+package recycleme
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Preparation is how to prepare a material before throwing it away, e.g. remove the cap or flatten the box,
+// with warnings (e.g. do not put it in a bag).
+// As the bins, it depends on the region: the preparation of the most specific region of a material is used,
+// the empty region holding the default preparations. It is inherited through the taxonomy of materials, as bin rules.
+type Preparation struct {
+	MaterialID uint     `json:"material_id" bson:"material_id"`
+	Region     string   `json:"region" bson:"region"`
+	Steps      []string `json:"steps" bson:"steps"` // in order
+	Warnings   []string `json:"warnings,omitempty" bson:"warnings,omitempty"`
+}
+
+// decodePreparations reads a json list of Preparation and normalizes their region codes
+func decodePreparations(r io.Reader) ([]Preparation, error) {
+	var preparations []Preparation
+	if err := json.NewDecoder(r).Decode(&preparations); err != nil {
+		return nil, err
+	}
+	for i, p := range preparations {
+		code, err := regionCode(p.Region)
+		if err != nil {
+			return nil, err
+		}
+		preparations[i].Region = code
+	}
+	return preparations, nil
+}
+
+// mostSpecificPreparations returns the preparation of each material from its most specific region in codes (see Region.Codes).
+// As for bins (see mostSpecificBins), materials without a preparation of their own, whatever its region,
+// inherit the one of their closest ancestor in parents, keeping its MaterialID.
+func mostSpecificPreparations(preparations []Preparation, codes []string, parents map[uint]uint) map[uint]Preparation {
+	rank := make(map[string]int, len(codes))
+	for i, code := range codes {
+		rank[code] = i
+	}
+	best := make(map[uint]Preparation)
+	for _, p := range preparations {
+		i, ok := rank[p.Region]
+		if !ok {
+			continue
+		}
+		if b, found := best[p.MaterialID]; found && rank[b.Region] <= i {
+			continue
+		}
+		best[p.MaterialID] = p
+	}
+	inherited := make(map[uint]Preparation)
+	for id := range parents {
+		if _, ok := best[id]; ok {
+			continue
+		}
+		for _, ancestor := range materialLineage(id, parents)[1:] {
+			if p, ok := best[ancestor]; ok {
+				inherited[id] = p
+				break
+			}
+		}
+	}
+	for id, p := range inherited {
+		best[id] = p
+	}
+	return best
+}
+
+// MaterialDisposal is how to throw away a material of a package: its preparation steps, then its bin
+type MaterialDisposal struct {
+	Material Material `json:"material"`
+	Steps    []string `json:"steps,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Bin      *Bin     `json:"bin"` // nil if the material has no bin in the region
+}
+
+// DisposalPlan returns how to throw away each material of materials, in the same order, from their bins and preparations
+func DisposalPlan(materials []Material, bins map[Material]Bin, preparations map[uint]Preparation) []MaterialDisposal {
+	plan := make([]MaterialDisposal, 0, len(materials))
+	for _, m := range materials {
+		d := MaterialDisposal{Material: m}
+		if p, ok := preparations[m.ID]; ok {
+			d.Steps, d.Warnings = p.Steps, p.Warnings
+		}
+		if b, ok := bins[m]; ok {
+			d.Bin = &b
+		}
+		plan = append(plan, d)
+	}
+	return plan
+}
@@ -0,0 +1,138 @@
+package recycleme
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RegionHeader is the HTTP header of the region of a request, when there is no region query parameter
+const RegionHeader = "X-Recycleme-Region"
+
+// Region is where a package is thrown away: sorting rules are decided by the collectivity collecting waste,
+// so materials are mapped to bins by region.
+// Rules are looked up from the most specific region to the least specific one: commune, collectivity, department,
+// country, and finally the default rules (empty region code).
+type Region struct {
+	Country      string `json:"country,omitempty"`      // ISO 3166-1 alpha-2 code, e.g. FR
+	Department   string `json:"department,omitempty"`   // e.g. 75 or 2A, derived from the postcode of french communes
+	Collectivity string `json:"collectivity,omitempty"` // SIREN of the metropolis or intercommunality collecting waste, e.g. 200054781
+	Postcode     string `json:"postcode,omitempty"`     // postcode of the commune, e.g. 75011
+}
+
+// ParseRegion parses comma separated region codes, one per level:
+// a country (FR), a department (FR-75), a commune by its postcode (FR-75011) or a collectivity by its SIREN (FR-200054781).
+// The department of a french commune is derived from its postcode. An empty string is the default region.
+func ParseRegion(s string) (Region, error) {
+	var r Region
+	if strings.TrimSpace(s) == "" {
+		return r, nil
+	}
+	for _, code := range strings.Split(s, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		parts := strings.SplitN(code, "-", 2)
+		country := parts[0]
+		if len(country) != 2 || !isLetters(country) || (r.Country != "" && r.Country != country) {
+			return Region{}, fmt.Errorf("%w %v", errInvalidRegion, code)
+		}
+		r.Country = country
+		if len(parts) == 1 {
+			continue
+		}
+		local := parts[1]
+		switch {
+		case len(local) == 5 && isDigits(local) && r.Postcode == "":
+			r.Postcode = local
+		case len(local) == 9 && isDigits(local) && r.Collectivity == "":
+			r.Collectivity = local
+		case len(local) >= 1 && len(local) <= 3 && isAlphanumeric(local) && (r.Department == "" || r.Department == local):
+			r.Department = local
+		default:
+			return Region{}, fmt.Errorf("%w %v", errInvalidRegion, code)
+		}
+	}
+	if r.Country == "FR" && r.Postcode != "" {
+		department := frenchDepartment(r.Postcode)
+		if r.Department != "" && r.Department != department {
+			return Region{}, fmt.Errorf("%w %v: postcode %v is not in department %v", errInvalidRegion, s, r.Postcode, r.Department)
+		}
+		r.Department = department
+	}
+	return r, nil
+}
+
+// frenchDepartment returns the department of a french postcode: its first 2 digits, 3 for overseas departments,
+// 2A or 2B for Corsica
+func frenchDepartment(postcode string) string {
+	switch {
+	case strings.HasPrefix(postcode, "97"), strings.HasPrefix(postcode, "98"):
+		return postcode[:3]
+	case strings.HasPrefix(postcode, "200"), strings.HasPrefix(postcode, "201"):
+		return "2A"
+	case strings.HasPrefix(postcode, "20"):
+		return "2B"
+	}
+	return postcode[:2]
+}
+
+// Codes returns the region codes of r from the most specific to the least specific, the last one being the default region ""
+func (r Region) Codes() []string {
+	var codes []string
+	if r.Country != "" {
+		for _, local := range []string{r.Postcode, r.Collectivity, r.Department} {
+			if local != "" {
+				codes = append(codes, r.Country+"-"+local)
+			}
+		}
+		codes = append(codes, r.Country)
+	}
+	return append(codes, "")
+}
+
+// String returns the codes of r, as parsed by ParseRegion
+func (r Region) String() string {
+	codes := r.Codes()
+	return strings.Join(codes[:len(codes)-1], ",")
+}
+
+// regionCode returns the canonical code of a single region code, as stored with bin rules
+func regionCode(code string) (string, error) {
+	r, err := ParseRegion(code)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(code, ",") {
+		return "", fmt.Errorf("%w %v: a single code is expected", errInvalidRegion, code)
+	}
+	return r.Codes()[0], nil
+}
+
+// RegionFromRequest returns the region of the region query parameter or of the RegionHeader, defaultRegion if there is none
+func RegionFromRequest(r *http.Request, defaultRegion Region) (Region, error) {
+	s := r.URL.Query().Get("region")
+	if s == "" {
+		s = r.Header.Get(RegionHeader)
+	}
+	if s == "" {
+		return defaultRegion, nil
+	}
+	return ParseRegion(s)
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
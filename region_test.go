@@ -0,0 +1,80 @@
+package recycleme
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseRegion(t *testing.T) {
+	for s, expected := range map[string]Region{
+		"":                               {},
+		"fr":                             {Country: "FR"},
+		"FR-75":                          {Country: "FR", Department: "75"},
+		"FR-75011":                       {Country: "FR", Department: "75", Postcode: "75011"},
+		"FR-20000":                       {Country: "FR", Department: "2A", Postcode: "20000"},
+		"FR-20200":                       {Country: "FR", Department: "2B", Postcode: "20200"},
+		"FR-97400":                       {Country: "FR", Department: "974", Postcode: "97400"},
+		"FR-75011, FR-200054781":         {Country: "FR", Department: "75", Collectivity: "200054781", Postcode: "75011"},
+		"FR-75011,FR-200054781,FR-75,FR": {Country: "FR", Department: "75", Collectivity: "200054781", Postcode: "75011"},
+		"DE-10115":                       {Country: "DE", Postcode: "10115"},
+	} {
+		r, err := ParseRegion(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if r != expected {
+			t.Errorf("%q: expected %+v, got %+v", s, expected, r)
+		}
+	}
+
+	for _, s := range []string{"F", "FRA", "75011", "FR-", "FR-1234", "FR-75011,DE", "FR-75011,FR-69", "FR-75011,FR-69001"} {
+		if _, err := ParseRegion(s); !errors.Is(err, errInvalidRegion) {
+			t.Errorf("%q should be invalid, got %v", s, err)
+		}
+	}
+}
+
+func TestRegionCodes(t *testing.T) {
+	r := Region{Country: "FR", Department: "75", Collectivity: "200054781", Postcode: "75011"}
+	expected := []string{"FR-75011", "FR-200054781", "FR-75", "FR", ""}
+	if codes := r.Codes(); !reflect.DeepEqual(codes, expected) {
+		t.Errorf("expected codes %v, got %v", expected, codes)
+	}
+	if parsed, err := ParseRegion(r.String()); err != nil || parsed != r {
+		t.Errorf("%v should be parsed back, got %+v (%v)", r.String(), parsed, err)
+	}
+	if codes := (Region{}).Codes(); !reflect.DeepEqual(codes, []string{""}) {
+		t.Errorf("the default region should only have the default rules, got %v", codes)
+	}
+
+	if code, err := regionCode("fr-75011"); err != nil || code != "FR-75011" {
+		t.Errorf("expected FR-75011, got %v (%v)", code, err)
+	}
+	if _, err := regionCode("FR-75011,FR-200054781"); !errors.Is(err, errInvalidRegion) {
+		t.Errorf("rules must have a single region, got %v", err)
+	}
+}
+
+func TestRegionFromRequest(t *testing.T) {
+	paris := Region{Country: "FR", Department: "75"}
+	for _, test := range []struct {
+		url, header string
+		expected    Region
+	}{
+		{"/throwaway/7613034383808", "", paris},
+		{"/throwaway/7613034383808?region=FR-69", "FR-13", Region{Country: "FR", Department: "69"}},
+		{"/throwaway/7613034383808", "FR-13", Region{Country: "FR", Department: "13"}},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.header != "" {
+			req.Header.Set(RegionHeader, test.header)
+		}
+		if r, err := RegionFromRequest(req, paris); err != nil || r != test.expected {
+			t.Errorf("%v (%v): expected %+v, got %+v (%v)", test.url, test.header, test.expected, r, err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package recycleme
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var updateFixtures = flag.Bool("update", false, "record the responses of the real websites as fixtures in testdata/replay")
+
+// replayDir holds the responses of websites recorded with -update, one raw HTTP response per request
+const replayDir = "testdata/replay"
+
+// replayTransport serves the responses recorded in dir, or records them from the real websites if record is set
+type replayTransport struct {
+	dir    string
+	record bool
+	real   http.RoundTripper
+}
+
+var fixtureNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixturePath returns the file of the response to a request: its url, and the hash of its body if it is not a GET
+func (t replayTransport) fixturePath(req *http.Request, body []byte) string {
+	name := fixtureNameChars.ReplaceAllString(req.URL.Host+req.URL.RequestURI(), "_")
+	if req.Method != "GET" {
+		sum := sha256.Sum256(body)
+		name = strings.ToLower(req.Method) + "_" + name + "_" + hex.EncodeToString(sum[:4])
+	}
+	return filepath.Join(t.dir, name+".http")
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	path := t.fixturePath(req, body)
+
+	if !t.record {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no fixture %v for %v %v, record it with go test -update", path, req.Method, req.URL)
+		} else if err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	}
+
+	resp, err := t.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return nil, err
+	}
+	return resp, ioutil.WriteFile(path, b, 0644)
+}
+
+// replayFixtures makes client replay the responses of testdata/replay until the returned function is called.
+// The test is skipped if no response was recorded yet.
+func replayFixtures(t *testing.T) func() {
+	if !*updateFixtures {
+		if fixtures, _ := filepath.Glob(filepath.Join(replayDir, "*.http")); len(fixtures) == 0 {
+			t.Skipf("no responses recorded in %v, record them from the real websites with go test -update", replayDir)
+		}
+	}
+	transport := client.Transport
+	real := transport
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	client.Transport = replayTransport{dir: replayDir, record: *updateFixtures, real: real}
+	if *updateFixtures {
+		t.Logf("recording fixtures in %v", replayDir)
+	}
+	return func() {
+		client.Transport = transport
+	}
+}
+
+func TestReplayTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	real := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		body, _ := ioutil.ReadAll(req.Body)
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+			Header:        http.Header{"Content-Type": []string{"text/plain"}},
+			Body:          ioutil.NopCloser(strings.NewReader("echo " + string(body))),
+			ContentLength: int64(len(body) + 5),
+			Request:       req,
+		}, nil
+	})
+	get := func(transport http.RoundTripper, body string) (*http.Response, string) {
+		req, _ := http.NewRequest("POST", "http://www.example.com/search?q=1", strings.NewReader(body))
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	recorder := replayTransport{dir: dir, record: true, real: real}
+	if _, body := get(recorder, "a"); body != "echo a" {
+		t.Errorf("recorder should return the real response, got %v", body)
+	}
+	get(recorder, "b")
+
+	player := replayTransport{dir: dir, real: real}
+	for _, body := range []string{"a", "b"} {
+		resp, replayed := get(player, body)
+		if replayed != "echo "+body || resp.StatusCode != http.StatusNotFound || resp.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("unexpected replayed response %v: %v", resp.Status, replayed)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("responses should be replayed without calling the website, got %v calls", calls)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.com/unknown", nil)
+	if _, err := player.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "-update") {
+		t.Errorf("missing fixtures should be reported, got %v", err)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,109 @@
+package recycleme
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy of transient failures: up to MaxAttempts requests, waiting BaseDelay, 2*BaseDelay, ... (with jitter) between them,
+// never more than MaxDelay. A zero RetryPolicy sends a single request.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used by the FetchableURL created with NewFetchableURL
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// backoff returns how long to wait after the attempt-th failed request (starting at 1), with full jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isRetryable returns true if err is transient: timeouts, connection resets, 429 and 5xx.
+// Our own rate limiter (errRateLimited), websites which gave up on us (errThrottled) and cancellations are not retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errRateLimited) || errors.Is(err, errThrottled) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// parseRetryAfter parses a Retry-After header, either in seconds or as an HTTP date. 0 if absent or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// fetchURL fetches url, retrying transient failures according to policy. It returns the number of requests sent.
+// A website still answering 429 when giving up is reported as errThrottled, unlike our own rate limiter (errRateLimited).
+func fetchURL(ctx context.Context, url string, policy RetryPolicy) ([]byte, int, error) {
+	attempts := 0
+	for {
+		attempts++
+		body, err := fetchURLOnce(ctx, url)
+		if err == nil {
+			return body, attempts, nil
+		}
+		if attempts >= policy.MaxAttempts || !isRetryable(err) {
+			return nil, attempts, finalFetchError(err)
+		}
+		wait := policy.backoff(attempts)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if statusErr.RetryAfter > policy.MaxDelay {
+				// not worth waiting for
+				return nil, attempts, finalFetchError(err)
+			}
+			wait = statusErr.RetryAfter
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, attempts, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func finalFetchError(err error) error {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		return errThrottled
+	}
+	return err
+}
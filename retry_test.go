@@ -0,0 +1,110 @@
+package recycleme
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	retryable := []error{
+		&httpStatusError{URL: "http://www.example.com", StatusCode: 503},
+		&httpStatusError{URL: "http://www.example.com", StatusCode: 429},
+		fmt.Errorf("read: %w", syscall.ECONNRESET),
+		context.DeadlineExceeded,
+	}
+	for _, err := range retryable {
+		if !isRetryable(err) {
+			t.Errorf("%v should be retried", err)
+		}
+	}
+	others := []error{
+		errNotFound,
+		errRateLimited,
+		errThrottled,
+		context.Canceled,
+		&httpStatusError{URL: "http://www.example.com", StatusCode: 403},
+	}
+	for _, err := range others {
+		if isRetryable(err) {
+			t.Errorf("%v should not be retried", err)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for header, expected := range map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"Fri, 01 Jan 2016 00:00:10 GMT": 10 * time.Second,
+		"Thu, 31 Dec 2015 00:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if d := parseRetryAfter(header, now); d != expected {
+			t.Errorf("Retry-After %q: expected %v, got %v", header, expected, d)
+		}
+	}
+}
+
+func TestFetchURLRetry(t *testing.T) {
+	requests := int32(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flaky") && n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case strings.HasPrefix(r.URL.Path, "/flaky"):
+			fmt.Fprint(w, "ok")
+		case strings.HasPrefix(r.URL.Path, "/slowdown"):
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasPrefix(r.URL.Path, "/down"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	SetHostRateLimit(host, RateLimit{PerSecond: 1000, Burst: 100})
+	defer SetHostRateLimit(host, DefaultRateLimit)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	body, attempts, err := fetchURL(context.Background(), ts.URL+"/flaky", policy)
+	if err != nil || string(body) != "ok" || attempts != 3 {
+		t.Errorf("expected success after 3 attempts, got %q, %v attempts, %v", body, attempts, err)
+	}
+
+	// Retry-After longer than MaxDelay: give up at once
+	atomic.StoreInt32(&requests, 0)
+	if _, attempts, err := fetchURL(context.Background(), ts.URL+"/slowdown", policy); err != errThrottled || attempts != 1 {
+		t.Errorf("expected throttled after 1 attempt, got %v attempts, %v", attempts, err)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	if _, attempts, err := fetchURL(context.Background(), ts.URL+"/missing", policy); err != errNotFound || attempts != 1 {
+		t.Errorf("not found should not be retried, got %v attempts, %v", attempts, err)
+	}
+
+	f := FetchableURL{URL: ts.URL + "/down/%s", WebsiteName: "test", HTMLParser: UpcItemDbFetcher.HTMLParser, Retry: policy}
+	_, err = f.Fetch(context.Background(), "5029053038896", blacklistDB)
+	if err == nil || err.(*productError).Attempts != 3 || !strings.HasSuffix(err.Error(), "after 3 attempts") {
+		t.Errorf("expected error after 3 attempts, got %v", err)
+	}
+
+	// waiting between attempts stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	if _, _, err := fetchURL(ctx, ts.URL+"/down", slow); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,170 @@
+package recycleme
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BinRule puts a material in a bin in a region, the empty region holding the default rules.
+// Sorting rules change over time (e.g. all plastic packaging going to the yellow bin), on a different date in each region,
+// so a rule is only valid from ValidFrom (included) until ValidUntil (excluded), zero times being unbounded.
+// When several rules of a region are valid for a material, the one which started last wins: a new rule set is staged
+// by adding rules starting on the day it takes effect.
+type BinRule struct {
+	Region     string    `json:"region" bson:"region"`
+	MaterialID uint      `json:"material_id" bson:"material_id"`
+	BinID      uint      `json:"bin_id" bson:"bin_id"`
+	ValidFrom  time.Time `json:"valid_from,omitempty" bson:"valid_from,omitempty"`
+	ValidUntil time.Time `json:"valid_until,omitempty" bson:"valid_until,omitempty"`
+}
+
+// ValidAt returns true if the rule applies at t
+func (rule BinRule) ValidAt(t time.Time) bool {
+	return (rule.ValidFrom.IsZero() || !t.Before(rule.ValidFrom)) && (rule.ValidUntil.IsZero() || t.Before(rule.ValidUntil))
+}
+
+// normalizeBinRule returns rule with its canonical region code, or an error if its validity period is empty
+func normalizeBinRule(rule BinRule) (BinRule, error) {
+	code, err := regionCode(rule.Region)
+	if err != nil {
+		return rule, fmt.Errorf("%w for material %v", err, rule.MaterialID)
+	}
+	rule.Region = code
+	if !rule.ValidFrom.IsZero() && !rule.ValidUntil.IsZero() && !rule.ValidUntil.After(rule.ValidFrom) {
+		return rule, fmt.Errorf("%w: material %v in %q is valid until %v, before %v", errInvalidBinRule, rule.MaterialID, rule.Region, rule.ValidUntil, rule.ValidFrom)
+	}
+	return rule, nil
+}
+
+// BinRulesDB stores the rules putting materials in bins
+type BinRulesDB interface {
+	// BinRules returns the rules of r and of its parent regions (see Region.Codes), whatever their validity period
+	BinRules(r Region) ([]BinRule, error)
+	AddBinRules(rules []BinRule) error
+}
+
+// RulesDB holds packages, materials and the bin rules to throw them away
+type RulesDB interface {
+	PackagesDB
+	MaterialDB
+	BinRulesDB
+}
+
+// DefaultUpcomingRulesWindow is how far ahead upcoming changes of rules are previewed by default
+const DefaultUpcomingRulesWindow = 365 * 24 * time.Hour
+
+// ParseDate parses a day (2006-01-02, at midnight UTC) or an RFC 3339 time
+func ParseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %v, expected 2006-01-02 or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// mostSpecificBins returns the bin ID of each material at t, from the valid rule of its most specific region in codes (see Region.Codes).
+// Materials inherit the rules of their ancestors in parents (see materialParents), unless overridden: a rule on the material itself,
+// whatever its region, wins over the rules of its ancestors, then the rules of its closest ancestor win.
+func mostSpecificBins(rules []BinRule, codes []string, t time.Time, parents map[uint]uint) map[uint]uint {
+	best := make(map[string]map[uint]BinRule, len(codes))
+	for _, code := range codes {
+		best[code] = make(map[uint]BinRule)
+	}
+	materialIDs := make(map[uint]bool)
+	for _, rule := range rules {
+		regionRules, ok := best[rule.Region]
+		if !ok || !rule.ValidAt(t) {
+			continue
+		}
+		if b, found := regionRules[rule.MaterialID]; found && !rule.ValidFrom.After(b.ValidFrom) {
+			continue
+		}
+		regionRules[rule.MaterialID] = rule
+		materialIDs[rule.MaterialID] = true
+	}
+	for id := range parents {
+		materialIDs[id] = true
+	}
+
+	bins := make(map[uint]uint)
+	for id := range materialIDs {
+		lineage := materialLineage(id, parents)
+	search:
+		for _, ancestor := range lineage {
+			for _, code := range codes {
+				if rule, ok := best[code][ancestor]; ok {
+					bins[id] = rule.BinID
+					break search
+				}
+			}
+		}
+	}
+	return bins
+}
+
+// BinChange is a material going to another bin on Date, From or To being nil if the material has no bin before or after
+type BinChange struct {
+	Date     time.Time `json:"date"`
+	Material Material  `json:"material"`
+	From     *Bin      `json:"from"`
+	To       *Bin      `json:"to"`
+}
+
+// UpcomingBinChanges returns the changes of bins of materials in region r after from, until to (included), sorted by date
+func UpcomingBinChanges(db RulesDB, r Region, from, to time.Time) ([]BinChange, error) {
+	rules, err := db.BinRules(r)
+	if err != nil {
+		return nil, err
+	}
+	var dates []time.Time
+	seen := make(map[time.Time]bool)
+	for _, rule := range rules {
+		for _, d := range []time.Time{rule.ValidFrom, rule.ValidUntil} {
+			if !d.IsZero() && d.After(from) && !d.After(to) && !seen[d.UTC()] {
+				seen[d.UTC()] = true
+				dates = append(dates, d.UTC())
+			}
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	changes := make([]BinChange, 0)
+	if len(dates) == 0 {
+		return changes, nil
+	}
+	materials, err := db.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	before, err := db.GetBins(materials, r, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dates {
+		after, err := db.GetBins(materials, r, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range materials {
+			b, hadBin := before[m]
+			a, hasBin := after[m]
+			if hadBin == hasBin && b.ID == a.ID {
+				continue
+			}
+			change := BinChange{Date: d, Material: m}
+			if hadBin {
+				change.From = &b
+			}
+			if hasBin {
+				change.To = &a
+			}
+			changes = append(changes, change)
+		}
+		before = after
+	}
+	return changes, nil
+}
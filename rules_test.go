@@ -0,0 +1,152 @@
+package recycleme
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMostSpecificBins(t *testing.T) {
+	now := time.Now()
+	rules := []BinRule{
+		{Region: "FR-75011", MaterialID: 1, BinID: 3},
+		{Region: "", MaterialID: 1, BinID: 1},
+		{Region: "FR-75", MaterialID: 1, BinID: 2},
+		{Region: "", MaterialID: 2, BinID: 1},
+		{Region: "FR-69", MaterialID: 2, BinID: 2},
+	}
+	r, _ := ParseRegion("FR-75011")
+	if bins := mostSpecificBins(rules, r.Codes(), now, nil); !reflect.DeepEqual(bins, map[uint]uint{1: 3, 2: 1}) {
+		t.Errorf("unexpected bins %v", bins)
+	}
+	r, _ = ParseRegion("FR-75012")
+	if bins := mostSpecificBins(rules, r.Codes(), now, nil); !reflect.DeepEqual(bins, map[uint]uint{1: 2, 2: 1}) {
+		t.Errorf("unexpected bins %v", bins)
+	}
+
+	// the rule which started last wins in a region, expired and future rules are ignored
+	rules = append(rules,
+		BinRule{Region: "", MaterialID: 2, BinID: 3, ValidFrom: now.AddDate(-1, 0, 0)},
+		BinRule{Region: "", MaterialID: 2, BinID: 4, ValidFrom: now.AddDate(0, 0, 1)},
+		BinRule{Region: "FR-75", MaterialID: 1, BinID: 4, ValidUntil: now},
+	)
+	if bins := mostSpecificBins(rules, r.Codes(), now, nil); !reflect.DeepEqual(bins, map[uint]uint{1: 2, 2: 3}) {
+		t.Errorf("unexpected bins %v", bins)
+	}
+	if bins := mostSpecificBins(rules, r.Codes(), now.AddDate(0, 0, 1), nil); !reflect.DeepEqual(bins, map[uint]uint{1: 2, 2: 4}) {
+		t.Errorf("unexpected bins %v", bins)
+	}
+}
+
+func TestBinRuleValidAt(t *testing.T) {
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for rule, expected := range map[BinRule][]bool{
+		{}:                                   {true, true, true, true},
+		{ValidFrom: from}:                    {false, true, true, true},
+		{ValidUntil: until}:                  {true, true, true, false},
+		{ValidFrom: from, ValidUntil: until}: {false, true, true, false},
+	} {
+		for i, at := range []time.Time{from.Add(-time.Second), from, until.Add(-time.Second), until} {
+			if rule.ValidAt(at) != expected[i] {
+				t.Errorf("%+v valid at %v should be %v", rule, at, expected[i])
+			}
+		}
+	}
+
+	if _, err := normalizeBinRule(BinRule{Region: "FR-75", ValidFrom: until, ValidUntil: from}); !errors.Is(err, errInvalidBinRule) {
+		t.Errorf("rules must end after they start, got %v", err)
+	}
+	if _, err := normalizeBinRule(BinRule{Region: "Paris"}); !errors.Is(err, errInvalidRegion) {
+		t.Errorf("rules must have a valid region, got %v", err)
+	}
+	if rule, err := normalizeBinRule(BinRule{Region: "fr-75"}); err != nil || rule.Region != "FR-75" {
+		t.Errorf("expected region FR-75, got %v (%v)", rule.Region, err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for s, expected := range map[string]time.Time{
+		"2023-01-01":                time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		"2023-01-01T10:00:00+01:00": time.Date(2023, 1, 1, 9, 0, 0, 0, time.UTC),
+	} {
+		if d, err := ParseDate(s); err != nil || !d.Equal(expected) {
+			t.Errorf("%v: expected %v, got %v (%v)", s, expected, d, err)
+		}
+	}
+	if _, err := ParseDate("01/01/2023"); err == nil {
+		t.Error("invalid dates should not be parsed")
+	}
+}
+
+// testBinRulesDB stages rules in region (which must have no rules) and checks they only apply during their validity period
+func testBinRulesDB(t *testing.T, db RulesDB, region string) {
+	r, err := ParseRegion(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	start, end := now.AddDate(0, 1, 0), now.AddDate(0, 2, 0)
+	if err := db.AddBinRules([]BinRule{
+		{Region: region, MaterialID: 2, BinID: 2, ValidFrom: start, ValidUntil: end},
+		{Region: region, MaterialID: 5, BinID: 1},
+		{Region: region, MaterialID: 5, BinID: 4, ValidFrom: start},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddBinRules([]BinRule{{Region: region, MaterialID: 2, BinID: 2, ValidFrom: end, ValidUntil: start}}); !errors.Is(err, errInvalidBinRule) {
+		t.Errorf("rules must end after they start, got %v", err)
+	}
+	if rules, err := db.BinRules(r); err != nil || len(rules) < 3 {
+		t.Errorf("expected the staged rules and the default ones, got %v (%v)", rules, err)
+	}
+
+	film, food := Material{ID: 2, Name: "Film plastique"}, Material{ID: 5, Name: "Nourriture"}
+	for _, test := range []struct {
+		at         time.Time
+		film, food string
+	}{
+		{now, "Bac à couvercle vert", "Bac à couvercle vert"},
+		{start, "Bac à couvercle jaune", "Bac à couvercle marron"},
+		{end, "Bac à couvercle vert", "Bac à couvercle marron"},
+	} {
+		bins, err := db.GetBins([]Material{film, food}, r, test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bins[film].Name != test.film || bins[food].Name != test.food {
+			t.Errorf("at %v, expected %v and %v, got %v", test.at, test.film, test.food, bins)
+		}
+	}
+
+	changes, err := UpcomingBinChanges(db, r, now, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		date     time.Time
+		material string
+		from, to string
+	}{
+		{start, film.Name, "Bac à couvercle vert", "Bac à couvercle jaune"},
+		{start, food.Name, "Bac à couvercle vert", "Bac à couvercle marron"},
+		{end, film.Name, "Bac à couvercle jaune", "Bac à couvercle vert"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %v changes, got %+v", len(expected), changes)
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if !c.Date.Equal(e.date) || c.Material.Name != e.material || c.From == nil || c.From.Name != e.from || c.To == nil || c.To.Name != e.to {
+			t.Errorf("expected %+v, got %+v", e, c)
+		}
+	}
+	if changes, err := UpcomingBinChanges(db, r, now, start.Add(-time.Second)); err != nil || len(changes) != 0 {
+		t.Errorf("no changes expected before %v, got %+v (%v)", start, changes, err)
+	}
+}
+
+func TestBinRulesDB(t *testing.T) {
+	testBinRulesDB(t, packageDB, "FR-13")
+}
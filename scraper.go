@@ -0,0 +1,614 @@
+package recycleme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"gopkg.in/yaml.v2"
+)
+
+// ScraperDefinition describes how to scrape a website, so adding or fixing a source is a matter of configuration.
+// Definitions are written in YAML, or JSON which is valid YAML:
+//
+//	name: UPCItemDB
+//	url: http://www.upcitemdb.com/upc/%s
+//	product_name:
+//	  selector: p.detailtitle b
+//	image:
+//	  selector: img[class*=product]
+//	  attr: src
+//
+// Pages are HTML by default, rules then use CSS selectors. With the json format, rules use paths instead.
+// A product is found when the Found condition is met if set, otherwise when it has a name, or an image if there is no product_name rule.
+type ScraperDefinition struct {
+	Name             string           `yaml:"name"`       // Name of the website, also the name of its fetcher
+	URL              string           `yaml:"url"`        // URL to scrape, %s is replaced by the EAN
+	Barcode          string           `yaml:"barcode"`    // Representation of the EAN in URL: gtin (default), ean13, ean8, upca, upce, gtin14 or isbn10
+	Categories       []string         `yaml:"categories"` // Categories of codes held by the website: product, restricted, book, periodical or coupon. All if empty
+	Format           string           `yaml:"format"`     // html (default) or json
+	Charset          string           `yaml:"charset"`    // Charset of the pages if they do not declare it (byte order mark or meta tag), e.g. iso-8859-1
+	ProductName      ScraperRule      `yaml:"product_name"`
+	Image            ScraperRule      `yaml:"image"`
+	Link             ScraperRule      `yaml:"link"`              // Link to the product page, the scraped URL if not set
+	Packaging        ScraperPackaging `yaml:"packaging"`         // Packaging data, json only
+	DefaultPackaging *PackagingData   `yaml:"default_packaging"` // Packaging of products when the website does not describe it, e.g. paper for books
+	Found            ScraperCondition `yaml:"found"`             // When set, the product is found only if it is met
+	TooManyResults   ScraperCondition `yaml:"too_many_results"`  // When met, the search returned several products
+}
+
+const (
+	scraperFormatHTML = "html"
+	scraperFormatJSON = "json"
+)
+
+// ScraperRule extracts a value from the first element matching the CSS Selector: its Attr attribute, or its text if Attr is empty.
+// In json, the value is the one at Path, keys and array indexes separated by dots (e.g. product.images.0.url).
+// If Pattern is set, the value is its first submatch. Template is a format string where %s is replaced by the value.
+// Prefix is prepended to relative URLs. Whitespaces are collapsed.
+type ScraperRule struct {
+	Selector string `yaml:"selector"`
+	Attr     string `yaml:"attr"`
+	Path     string `yaml:"path"`
+	Pattern  string `yaml:"pattern"`
+	Template string `yaml:"template"`
+	Prefix   string `yaml:"prefix"`
+}
+
+// ScraperCondition is met when an element matches Selector (or a value exists at Path in json),
+// and its text equals Equals, contains Contains, or does not contain NotContains (if set)
+type ScraperCondition struct {
+	Selector    string `yaml:"selector"`
+	Path        string `yaml:"path"`
+	Equals      string `yaml:"equals"`
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+}
+
+// ScraperPackaging locates packaging data in json documents: Text is the path to a description, Tags the path to a list of tags,
+// and Parts the path to a list of objects with shape, material and recycling tags (as strings, or objects with an id)
+type ScraperPackaging struct {
+	Text  string `yaml:"text"`
+	Tags  string `yaml:"tags"`
+	Parts string `yaml:"parts"`
+}
+
+func (sp ScraperPackaging) isSet() bool {
+	return sp.Text != "" || sp.Tags != "" || sp.Parts != ""
+}
+
+// fromJSON returns the packaging data in doc, nil if there is none
+func (sp ScraperPackaging) fromJSON(doc interface{}) *PackagingData {
+	if !sp.isSet() {
+		return nil
+	}
+	data := PackagingData{}
+	if sp.Text != "" {
+		text, _ := jsonPath(doc, sp.Text)
+		data.Text = strings.TrimSpace(text)
+	}
+	if sp.Tags != "" {
+		tags, _ := jsonNode(doc, sp.Tags)
+		if list, ok := tags.([]interface{}); ok {
+			for _, tag := range list {
+				if tag, ok := tag.(string); ok && tag != "" {
+					data.Tags = append(data.Tags, tag)
+				}
+			}
+		}
+	}
+	if sp.Parts != "" {
+		parts, _ := jsonNode(doc, sp.Parts)
+		if list, ok := parts.([]interface{}); ok {
+			for _, part := range list {
+				part := PackagingPart{Shape: jsonTag(part, "shape"), Material: jsonTag(part, "material"), Recycling: jsonTag(part, "recycling")}
+				if part != (PackagingPart{}) {
+					data.Parts = append(data.Parts, part)
+				}
+			}
+		}
+	}
+	if data.Text == "" && len(data.Tags) == 0 && len(data.Parts) == 0 {
+		return nil
+	}
+	return &data
+}
+
+// jsonTag returns the tag at key in doc, either a string or an object with an id
+func jsonTag(doc interface{}, key string) string {
+	if tag, ok := jsonPath(doc, key); ok && tag != "" {
+		return tag
+	}
+	tag, _ := jsonPath(doc, key+".id")
+	return tag
+}
+
+type scraperRule struct {
+	ScraperRule
+	selector cascadia.Selector
+	pattern  *regexp.Regexp
+}
+
+func compileScraperRule(r ScraperRule, format string) (scraperRule, error) {
+	rule := scraperRule{ScraperRule: r}
+	if format == scraperFormatJSON && r.Selector != "" {
+		return rule, fmt.Errorf("selector %q in a json scraper, use path", r.Selector)
+	}
+	if r.Selector != "" {
+		var err error
+		if rule.selector, err = cascadia.Compile(r.Selector); err != nil {
+			return rule, fmt.Errorf("invalid selector %q: %v", r.Selector, err)
+		}
+	}
+	if r.Template != "" && strings.Count(r.Template, "%s") != 1 {
+		return rule, fmt.Errorf("template %q must contain %%s once", r.Template)
+	}
+	if r.Pattern != "" {
+		var err error
+		if rule.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return rule, fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+		}
+	}
+	return rule, nil
+}
+
+func (r scraperRule) isSet() bool {
+	return r.selector != nil || r.Path != ""
+}
+
+// fromHTML extracts the value of the rule from an HTML document
+func (r scraperRule) fromHTML(doc *html.Node) string {
+	if r.selector == nil {
+		return ""
+	}
+	n := r.selector.MatchFirst(doc)
+	if n == nil {
+		return ""
+	}
+	if r.Attr == "" {
+		return r.clean(nodeText(n))
+	}
+	for _, attr := range n.Attr {
+		if attr.Key == r.Attr {
+			return r.clean(attr.Val)
+		}
+	}
+	return ""
+}
+
+// fromJSON extracts the value of the rule from a decoded json document
+func (r scraperRule) fromJSON(doc interface{}) string {
+	if r.Path == "" {
+		return ""
+	}
+	value, _ := jsonPath(doc, r.Path)
+	return r.clean(value)
+}
+
+func (r scraperRule) clean(value string) string {
+	if r.pattern != nil {
+		m := r.pattern.FindStringSubmatch(value)
+		if len(m) < 2 {
+			return ""
+		}
+		value = m[1]
+	}
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return ""
+	}
+	if r.Template != "" {
+		value = fmt.Sprintf(r.Template, value)
+	}
+	if r.Prefix != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		value = r.Prefix + value
+	}
+	return value
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var fn func(*html.Node)
+	fn = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			fn(c)
+		}
+	}
+	fn(n)
+	return b.String()
+}
+
+// jsonNode returns the node at path in doc, and false if there is none
+func jsonNode(doc interface{}, path string) (interface{}, bool) {
+	v := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonPath returns the value at path in doc (decoded with UseNumber) as a string, and false if there is none.
+// Objects and arrays have no string value.
+func jsonPath(doc interface{}, path string) (string, bool) {
+	v, ok := jsonNode(doc, path)
+	if !ok {
+		return "", false
+	}
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", false
+	}
+	return "", true
+}
+
+type scraperCondition struct {
+	ScraperCondition
+	selector cascadia.Selector
+}
+
+func compileScraperCondition(c ScraperCondition, format string) (scraperCondition, error) {
+	cond := scraperCondition{ScraperCondition: c}
+	if format == scraperFormatJSON && c.Selector != "" {
+		return cond, fmt.Errorf("selector %q in a json scraper, use path", c.Selector)
+	}
+	if c.Selector != "" {
+		var err error
+		if cond.selector, err = cascadia.Compile(c.Selector); err != nil {
+			return cond, fmt.Errorf("invalid selector %q: %v", c.Selector, err)
+		}
+	}
+	return cond, nil
+}
+
+func (c scraperCondition) isSet() bool {
+	return c.selector != nil || c.Path != ""
+}
+
+func (c scraperCondition) matches(txt string) bool {
+	return (c.Equals == "" || txt == c.Equals) &&
+		(c.Contains == "" || strings.Contains(txt, c.Contains)) &&
+		(c.NotContains == "" || !strings.Contains(txt, c.NotContains))
+}
+
+func (c scraperCondition) metInHTML(doc *html.Node) bool {
+	if c.selector == nil {
+		return false
+	}
+	n := c.selector.MatchFirst(doc)
+	return n != nil && c.matches(strings.TrimSpace(nodeText(n)))
+}
+
+func (c scraperCondition) metInJSON(doc interface{}) bool {
+	if c.Path == "" {
+		return false
+	}
+	txt, ok := jsonPath(doc, c.Path)
+	return ok && c.matches(txt)
+}
+
+// scraperParser is an HTMLParser driven by a ScraperDefinition
+type scraperParser struct {
+	format, charset   string
+	name, image, link scraperRule
+	packaging         ScraperPackaging
+	defaultPackaging  *PackagingData
+	found, tooMany    scraperCondition
+}
+
+func newScraperParser(def ScraperDefinition) (scraperParser, error) {
+	p := scraperParser{format: def.Format, charset: def.Charset, packaging: def.Packaging, defaultPackaging: def.DefaultPackaging}
+	switch p.format {
+	case "":
+		p.format = scraperFormatHTML
+	case scraperFormatHTML, scraperFormatJSON:
+	default:
+		return p, fmt.Errorf("unknown format %q", def.Format)
+	}
+	var err error
+	if p.name, err = compileScraperRule(def.ProductName, p.format); err != nil {
+		return p, err
+	}
+	if p.image, err = compileScraperRule(def.Image, p.format); err != nil {
+		return p, err
+	}
+	if p.link, err = compileScraperRule(def.Link, p.format); err != nil {
+		return p, err
+	}
+	if !p.name.isSet() && !p.image.isSet() {
+		return p, fmt.Errorf("no product_name nor image rule")
+	}
+	if p.format != scraperFormatJSON && p.packaging.isSet() {
+		return p, fmt.Errorf("packaging is only supported in json scrapers")
+	}
+	if p.found, err = compileScraperCondition(def.Found, p.format); err != nil {
+		return p, err
+	}
+	if p.tooMany, err = compileScraperCondition(def.TooManyResults, p.format); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+func (f scraperParser) ParseBody(b []byte) (Product, error) {
+	var p Product
+	var err error
+	found := false
+	if f.format == scraperFormatJSON {
+		p, found, err = f.parseJSON(b)
+	} else {
+		p, found, err = f.parseHTML(b)
+	}
+	if err != nil {
+		return Product{}, err
+	}
+	if !f.found.isSet() {
+		found = p.Name != "" || (!f.name.isSet() && p.ImageURL != "")
+	}
+	if !found {
+		return Product{}, errNotFound
+	}
+	if p.Packaging == nil && f.defaultPackaging != nil {
+		packaging := *f.defaultPackaging
+		p.Packaging = &packaging
+	}
+	return p, nil
+}
+
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset`)
+
+// declaresCharset returns true if an html page declares its charset, with a byte order mark or a meta tag in its first 1024 bytes
+func declaresCharset(b []byte) bool {
+	if bytes.HasPrefix(b, []byte("\xef\xbb\xbf")) || bytes.HasPrefix(b, []byte("\xfe\xff")) || bytes.HasPrefix(b, []byte("\xff\xfe")) {
+		return true
+	}
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+	return metaCharset.Match(b)
+}
+
+func (f scraperParser) parseHTML(b []byte) (Product, bool, error) {
+	p := Product{}
+	contentType := "text/html"
+	if f.charset != "" && !declaresCharset(b) {
+		contentType += "; charset=" + f.charset
+	}
+	r, err := charset.NewReader(bytes.NewReader(b), contentType)
+	if err != nil {
+		return p, false, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return p, false, err
+	}
+	if f.tooMany.metInHTML(doc) {
+		return p, false, errTooManyProducts
+	}
+	p.Name = f.name.fromHTML(doc)
+	p.ImageURL = f.image.fromHTML(doc)
+	p.WebsiteURL = f.link.fromHTML(doc)
+	return p, f.found.metInHTML(doc), nil
+}
+
+func (f scraperParser) parseJSON(b []byte) (Product, bool, error) {
+	p := Product{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return p, false, err
+	}
+	if f.tooMany.metInJSON(doc) {
+		return p, false, errTooManyProducts
+	}
+	p.Name = f.name.fromJSON(doc)
+	p.ImageURL = f.image.fromJSON(doc)
+	p.WebsiteURL = f.link.fromJSON(doc)
+	p.Packaging = f.packaging.fromJSON(doc)
+	return p, f.found.metInJSON(doc), nil
+}
+
+// NewScraperFetcher creates a FetchableURL scraping a website as described by def
+func NewScraperFetcher(def ScraperDefinition) (FetchableURL, error) {
+	if def.Name == "" {
+		return FetchableURL{}, fmt.Errorf("scraper for %v has no name", def.URL)
+	}
+	parser, err := newScraperParser(def)
+	if err != nil {
+		return FetchableURL{}, fmt.Errorf("scraper %v: %v", def.Name, err)
+	}
+	barcode, err := parseBarcodeFormat(def.Barcode)
+	if err != nil {
+		return FetchableURL{}, fmt.Errorf("scraper %v: %v", def.Name, err)
+	}
+	var categories []BarcodeCategory
+	for _, c := range def.Categories {
+		switch category := BarcodeCategory(c); category {
+		case CategoryProduct, CategoryRestricted, CategoryBook, CategoryPeriodical, CategoryCoupon:
+			categories = append(categories, category)
+		default:
+			return FetchableURL{}, fmt.Errorf("scraper %v: unknown category %q", def.Name, c)
+		}
+	}
+	f, err := NewFetchableURL(def.URL, def.Name, parser)
+	f.Barcode = barcode
+	f.Categories = categories
+	return f, err
+}
+
+// LoadScraperDefinitions reads all definitions (.yaml, .yml or .json files) in dir, sorted by file name.
+// A file may hold a single definition or a list of definitions.
+func LoadScraperDefinitions(dir string) ([]ScraperDefinition, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		switch filepath.Ext(file.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !file.IsDir() {
+				names = append(names, file.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var defs []ScraperDefinition
+	for _, name := range names {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var list []ScraperDefinition
+		if err := yaml.UnmarshalStrict(b, &list); err != nil {
+			var def ScraperDefinition
+			if err := yaml.UnmarshalStrict(b, &def); err != nil {
+				return nil, fmt.Errorf("invalid scraper definition %v: %v", name, err)
+			}
+			list = []ScraperDefinition{def}
+		}
+		defs = append(defs, list...)
+	}
+	return defs, nil
+}
+
+// withScrapers replaces the fetchers with the same name as a definition, and appends the others
+func withScrapers(fetchers []Fetcher, defs []ScraperDefinition) ([]Fetcher, error) {
+	for _, def := range defs {
+		scraper, err := NewScraperFetcher(def)
+		if err != nil {
+			return fetchers, err
+		}
+		replaced := false
+		for i, f := range fetchers {
+			if fetcherName(f) == def.Name {
+				fetchers[i] = scraper
+				replaced = true
+			}
+		}
+		if !replaced {
+			fetchers = append(fetchers, scraper)
+		}
+	}
+	return fetchers, nil
+}
+
+// openFactsScraper describes the json api of OpenFoodFacts and its sister databases, which share the same format
+func openFactsScraper(name, host string) ScraperDefinition {
+	return ScraperDefinition{
+		Name:        name,
+		URL:         "http://" + host + "/api/v0/produit/%s.json",
+		Format:      scraperFormatJSON,
+		ProductName: ScraperRule{Path: "product.product_name"},
+		Image:       ScraperRule{Path: "product.image_front_url"},
+		Link:        ScraperRule{Path: "code", Template: "http://" + host + "/produit/%s/"},
+		Packaging:   ScraperPackaging{Text: "product.packaging", Tags: "product.packaging_tags", Parts: "product.packagings"},
+		Found:       ScraperCondition{Path: "status", Equals: "1"},
+		Categories:  []string{"product"},
+	}
+}
+
+var openFoodFactsScraper = openFactsScraper("OpenFoodFacts", "fr.openfoodfacts.org")
+
+var openBeautyFactsScraper = openFactsScraper("OpenBeautyFacts", "fr.openbeautyfacts.org")
+
+var openProductsFactsScraper = openFactsScraper("OpenProductsFacts", "fr.openproductsfacts.org")
+
+var openPetFoodFactsScraper = openFactsScraper("OpenPetFoodFacts", "fr.openpetfoodfacts.org")
+
+var upcItemDbScraper = ScraperDefinition{
+	Name:        "UPCItemDB",
+	URL:         "http://www.upcitemdb.com/upc/%s",
+	ProductName: ScraperRule{Selector: "p.detailtitle b"},
+	Image:       ScraperRule{Selector: "img[class*=product]", Attr: "src"},
+	Categories:  []string{"product", "book", "periodical"},
+}
+
+// isbnSearchScraper looks up books, which are mostly made of paper
+var isbnSearchScraper = ScraperDefinition{
+	Name:             "ISBNSearch",
+	URL:              "https://isbnsearch.org/isbn/%s",
+	Barcode:          "isbn",
+	ProductName:      ScraperRule{Selector: "div.bookinfo h1"},
+	Image:            ScraperRule{Selector: "div.image img", Attr: "src"},
+	DefaultPackaging: &PackagingData{Tags: []string{"en:paper"}},
+	Categories:       []string{"book"},
+}
+
+var iGalerieScraper = ScraperDefinition{
+	Name:           "90.80.54.225",
+	URL:            "http://90.80.54.225/?search=%s",
+	Image:          ScraperRule{Selector: "a.img_link[style]", Attr: "style", Pattern: `background:url\(/getimg\.php\?img=([^)]*)\)`, Prefix: "http://90.80.54.225/albums/"},
+	TooManyResults: ScraperCondition{Selector: "#search_result > p", NotContains: "1 image trouv"},
+	Categories:     []string{"product"},
+}
+
+var starrymartScraper = ScraperDefinition{
+	Name:        "StarryMart",
+	URL:         "https://starrymart.co.uk/catalogsearch/result/?q=%s",
+	ProductName: ScraperRule{Selector: "div.item-img-info > a", Attr: "title"},
+	Image:       ScraperRule{Selector: "div.item-img-info > a img", Attr: "src"},
+	Link:        ScraperRule{Selector: "div.item-img-info > a", Attr: "href"},
+	Categories:  []string{"product"},
+}
+
+var misterPharmaWebScraper = ScraperDefinition{
+	Name:        "MisterPharmaWeb",
+	URL:         "http://www.misterpharmaweb.com/recherche-resultats.php?search_in_description=1&ac_keywords=%s",
+	Charset:     "iso-8859-1",
+	ProductName: ScraperRule{Selector: "img.lazy", Attr: "alt"},
+	Image:       ScraperRule{Selector: "img.lazy", Attr: "data-src", Prefix: "http://www.misterpharmaweb.com/"},
+	Link:        ScraperRule{Selector: "a:haschild(img.lazy)", Attr: "href"},
+	Categories:  []string{"product"},
+}
+
+var medisparScraper = ScraperDefinition{
+	Name:        "Medispar",
+	URL:         "http://www.meddispar.fr/content/search?search_by_name=&search_by_cip=%s",
+	Charset:     "iso-8859-1",
+	ProductName: ScraperRule{Selector: "a.drug_title", Attr: "title"},
+	Link:        ScraperRule{Selector: "a.drug_title", Attr: "href", Prefix: "http://www.meddispar.fr"},
+	Categories:  []string{"product"},
+}
+
+var picardScraper = ScraperDefinition{
+	Name:        "Picard",
+	URL:         "http://www.picard.fr/recherche?q=%s",
+	ProductName: ScraperRule{Selector: "a.productGTMSearchImg", Attr: "title"},
+	Image:       ScraperRule{Selector: "a.productGTMSearchImg img", Attr: "src"},
+	Link:        ScraperRule{Selector: "a.productGTMSearchImg", Attr: "href", Prefix: "http://www.picard.fr"},
+	Categories:  []string{"product"},
+}
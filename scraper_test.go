@@ -0,0 +1,194 @@
+package recycleme
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestScraperDefinitions(t *testing.T) {
+	tests := []struct {
+		file string
+		def  ScraperDefinition
+		p    Product
+		err  error
+	}{
+		{"html/upcitemdb.html", upcItemDbScraper, Product{Name: "Kleenex tissues in a Christmas House box", ImageURL: "http://www.staples.co.uk/content/images/product/428056_1_xnl.jpg"}, nil},
+		{"html/igalerie.html", iGalerieScraper, Product{ImageURL: "http://90.80.54.225/albums/Permanent/LOGIDIS2/8714789941011.jpg"}, nil},
+		{"html/igalerie_many.html", iGalerieScraper, Product{}, errTooManyProducts},
+		{"html/starrymart.html", starrymartScraper, Product{Name: "Nissin Cup Noodles Beef Flavour 75g",
+			WebsiteURL: "https://starrymart.co.uk/nissin-cup-noodle-beef.html",
+			ImageURL:   "https://starrymart.co.uk/media/catalog/product/cache/1/small_image/202x303/9df78eab33525d08d6e5fb8d27136e95/4/8/4897878100026_5.jpg"}, nil},
+		{"html/misterpharmaweb.html", misterPharmaWebScraper, Product{Name: "HUMEX ALLERGIE CETIRIZINE 10 mg, comprimé pelliculé sécable",
+			WebsiteURL: "http://www.misterpharmaweb.com/humex-allergie-cetirizine-10-mg-comprime-pellicule-secable-xml-351_365-2807.html",
+			ImageURL:   "http://www.misterpharmaweb.com/images/imagecache/cetir_1425058129_180x180.jpg"}, nil},
+		{"html/meddispar.html", medisparScraper, Product{Name: "NUROFEN 400mg CPR ENR B/12",
+			WebsiteURL: "http://www.meddispar.fr/Medicaments/NUROFEN-400-B-12/(type)/cip/(value)/3400936864986"}, nil},
+		{"html/picard.html", picardScraper, Product{Name: "2 quiches lorraines",
+			WebsiteURL: "http://www.picard.fr/produits/2-quiches-lorraines-000000000000089138.html",
+			ImageURL:   "http://demandware.edgesuite.net/sits_pod39/dw/image/v2/AAHV_PRD/on/demandware.static/-/Sites-catalog-picard/default/dwe4154de5/produits/entrees-tartes-salades/pack/000000000000089138_P.png?sw=140&sh=82"}, nil},
+		{"html/isbnsearch.html", isbnSearchScraper, Product{Name: "The Go Programming Language (Addison-Wesley Professional Computing Series)",
+			ImageURL:  "https://images-na.ssl-images-amazon.com/images/I/41aSIuXGwJL._SL160_.jpg",
+			Packaging: &PackagingData{Tags: []string{"en:paper"}}}, nil},
+		{"html/notfound.html", isbnSearchScraper, Product{}, errNotFound},
+		{"html/notfound.html", upcItemDbScraper, Product{}, errNotFound},
+		{"html/notfound.html", iGalerieScraper, Product{}, errNotFound},
+		{"json/openfoodfacts.json", openFoodFactsScraper, Product{Name: "Four à Pierre Royale",
+			WebsiteURL: "http://fr.openfoodfacts.org/produit/7613034383808/",
+			ImageURL:   "http://static.openfoodfacts.org/images/products/761/303/438/3808/front_fr.8.400.jpg",
+			Packaging: &PackagingData{Text: "Carton,Film plastique", Tags: []string{"carton", "film-plastique"}, Parts: []PackagingPart{
+				{Shape: "en:box", Material: "en:cardboard", Recycling: "en:recycle"},
+				{Shape: "en:film", Material: "en:plastic"},
+			}}}, nil},
+		{"json/openfoodfacts_notfound.json", openFoodFactsScraper, Product{}, errNotFound},
+		{"json/openbeautyfacts.json", openBeautyFactsScraper, Product{Name: "Ultra Doux Shampooing Camomille",
+			WebsiteURL: "http://fr.openbeautyfacts.org/produit/3600523183227/",
+			ImageURL:   "http://static.openbeautyfacts.org/images/products/360/052/318/3227/front_fr.4.400.jpg",
+			Packaging:  &PackagingData{Text: "Flacon,Plastique", Tags: []string{"flacon", "plastique"}}}, nil},
+		{"json/openproductsfacts.json", openProductsFactsScraper, Product{Name: "Éponges grattantes x4",
+			WebsiteURL: "http://fr.openproductsfacts.org/produit/3178041328203/",
+			ImageURL:   "http://static.openproductsfacts.org/images/products/317/804/132/8203/front_fr.3.400.jpg",
+			Packaging:  &PackagingData{Text: "Sachet,Plastique", Tags: []string{"sachet", "plastique"}}}, nil},
+		{"json/openpetfoodfacts.json", openPetFoodFactsScraper, Product{Name: "Friskies Junior au poulet",
+			WebsiteURL: "http://fr.openpetfoodfacts.org/produit/7613035256224/",
+			ImageURL:   "http://static.openpetfoodfacts.org/images/products/761/303/525/6224/front_fr.5.400.jpg",
+			Packaging:  &PackagingData{Text: "Carton", Tags: []string{"carton"}}}, nil},
+	}
+	for _, test := range tests {
+		b, err := ioutil.ReadFile("testdata/" + test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewScraperFetcher(test.def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := f.ParseBody(b)
+		if err != test.err {
+			t.Errorf("%v with %v: expected error %v, got %v", test.file, test.def.Name, test.err, err)
+		} else if !reflect.DeepEqual(p, test.p) {
+			t.Errorf("%v with %v: expected %v, got %v", test.file, test.def.Name, test.p, p)
+		}
+	}
+}
+
+func TestScraperFixturesBarcodes(t *testing.T) {
+	// fixtures must be of valid barcodes, as the fetchers never get other ones
+	for _, file := range []string{"openfoodfacts", "openbeautyfacts", "openproductsfacts", "openpetfoodfacts"} {
+		b, err := ioutil.ReadFile("testdata/json/" + file + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fixture struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(b, &fixture); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NormalizeBarcode(fixture.Code); err != nil {
+			t.Errorf("%v: invalid barcode %q: %v", file, fixture.Code, err)
+		}
+	}
+}
+
+func TestScraperCharset(t *testing.T) {
+	def := ScraperDefinition{Name: "charset", URL: "http://www.example.com/%s", Charset: "iso-8859-1", ProductName: ScraperRule{Selector: "h1"}}
+	f, err := NewScraperFetcher(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []string{
+		"<html><body><h1>Caf\xe9</h1></body></html>",
+		"<html><head><meta charset=\"utf-8\"></head><body><h1>Café</h1></body></html>",
+		"<html><head><meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\"></head><body><h1>Café</h1></body></html>",
+	} {
+		if p, err := f.ParseBody([]byte(page)); err != nil || p.Name != "Café" {
+			t.Errorf("%q: expected Café, got %q (%v)", page, p.Name, err)
+		}
+	}
+}
+
+func TestInvalidScraperDefinitions(t *testing.T) {
+	for _, def := range []ScraperDefinition{
+		{URL: "http://www.example.com/%s", ProductName: ScraperRule{Selector: "h1"}},
+		{Name: "NoRule", URL: "http://www.example.com/%s"},
+		{Name: "NoEAN", URL: "http://www.example.com/", ProductName: ScraperRule{Selector: "h1"}},
+		{Name: "Selector", URL: "http://www.example.com/%s", ProductName: ScraperRule{Selector: "h1["}},
+		{Name: "Pattern", URL: "http://www.example.com/%s", ProductName: ScraperRule{Selector: "h1", Pattern: "("}},
+		{Name: "Template", URL: "http://www.example.com/%s", ProductName: ScraperRule{Selector: "h1", Template: "http://www.example.com/"}},
+		{Name: "Format", URL: "http://www.example.com/%s", Format: "xml", ProductName: ScraperRule{Path: "name"}},
+		{Name: "JSON", URL: "http://www.example.com/%s", Format: "json", ProductName: ScraperRule{Selector: "h1"}},
+		{Name: "Barcode", URL: "http://www.example.com/%s", Barcode: "isbn13", ProductName: ScraperRule{Selector: "h1"}},
+		{Name: "JSONCondition", URL: "http://www.example.com/%s", Format: "json", ProductName: ScraperRule{Path: "name"}, Found: ScraperCondition{Selector: "h1"}},
+	} {
+		if _, err := NewScraperFetcher(def); err == nil {
+			t.Errorf("%+v should be invalid", def)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"status": json.Number("1"),
+		"found":  true,
+		"product": map[string]interface{}{
+			"name":   "name",
+			"images": []interface{}{map[string]interface{}{"url": "http://www.example.com/0.jpg"}},
+			"empty":  nil,
+		},
+	}
+	for path, expected := range map[string]struct {
+		value string
+		ok    bool
+	}{
+		"status":               {"1", true},
+		"found":                {"true", true},
+		"product.name":         {"name", true},
+		"product.images.0.url": {"http://www.example.com/0.jpg", true},
+		"product.images.1.url": {"", false},
+		"product.images.url":   {"", false},
+		"product.empty":        {"", false},
+		"product.missing":      {"", false},
+		"product":              {"", true},
+	} {
+		if value, ok := jsonPath(doc, path); value != expected.value || ok != expected.ok {
+			t.Errorf("%v: expected %q, %v, got %q, %v", path, expected.value, expected.ok, value, ok)
+		}
+	}
+}
+
+func TestLoadScraperDefinitions(t *testing.T) {
+	defs, err := LoadScraperDefinitions("testdata/scrapers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 2 || defs[0].Name != "ExampleShop" || defs[1].Name != "UPCItemDB" {
+		t.Fatalf("invalid definitions: %+v", defs)
+	}
+	if defs[0].TooManyResults.NotContains != "1 result" || defs[0].Image.Prefix != "https://shop.example.com" {
+		t.Errorf("invalid json definition: %+v", defs[0])
+	}
+
+	defer os.Unsetenv("RECYCLEME_SCRAPERS_DIR")
+	os.Setenv("RECYCLEME_SCRAPERS_DIR", "testdata/scrapers")
+	fetcher, _ := NewDefaultFetcher()
+	found := map[string]string{}
+	for _, f := range fetcher.fetchers {
+		if u, ok := f.(breakerFetcher).Fetcher.(FetchableURL); ok {
+			if _, ok := found[u.WebsiteName]; ok {
+				t.Errorf("%v is defined twice", u.WebsiteName)
+			}
+			found[u.WebsiteName] = u.URL
+		}
+	}
+	if found["UPCItemDB"] != "https://www.upcitemdb.com/upc/%s" || found["ExampleShop"] != "https://shop.example.com/search?ean=%s" || found["Picard"] == "" {
+		t.Errorf("definitions should replace or be added to built-in fetchers: %v", found)
+	}
+
+	os.Setenv("RECYCLEME_SCRAPERS_DIR", "testdata/missing")
+	if _, err := NewDefaultFetcher(); !os.IsNotExist(err) {
+		t.Error("missing scrapers directory should be reported")
+	}
+}
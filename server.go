@@ -1,13 +1,71 @@
 package recycleme
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
-	eancheck "github.com/nicholassm/go-ean"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// errorBody is the json body of error responses. Sources are the errors of each source when no product was found.
+type errorBody struct {
+	Error   string        `json:"error"`
+	Sources []sourceError `json:"sources,omitempty"`
+}
+
+type sourceError struct {
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error"`
+}
+
+// errorStatus maps err to an HTTP status: 400 for invalid barcodes, regions or rules, 404 for products not found (or only blacklisted or ambiguous),
+// 502 if sources failed, 500 otherwise
+func errorStatus(err error) int {
+	var errs fetchErrors
+	switch {
+	case errors.Is(err, errInvalidEAN), errors.Is(err, errInvalidRegion), errors.Is(err, errInvalidBinRule):
+		return http.StatusBadRequest
+	case errors.As(err, &errs):
+		if errs.missing() {
+			return http.StatusNotFound
+		}
+		return http.StatusBadGateway
+	case isNotFound(err), errors.Is(err, errBlacklisted), errors.Is(err, errTooManyProducts), errors.Is(err, errPackageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errUnavailable):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError answers with status and err as an errorBody, listing the error of each source if err is a fetchErrors
+func writeError(w http.ResponseWriter, err error, status int) {
+	body := errorBody{Error: err.Error()}
+	var errs fetchErrors
+	if errors.As(err, &errs) {
+		body.Error = "no product found"
+		if errs.Is(errUnavailable) {
+			body.Error += ", all sources are unavailable"
+		}
+		for _, e := range errs {
+			var pErr *productError
+			if errors.As(e, &pErr) {
+				body.Sources = append(body.Sources, sourceError{URL: pErr.URL, Error: pErr.err.Error()})
+			} else {
+				body.Sources = append(body.Sources, sourceError{Error: e.Error()})
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
 func NoCacheHandle(h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -17,6 +75,25 @@ func NoCacheHandle(h http.Handler) http.HandlerFunc {
 	}
 }
 
+// AdminHandle only serves POST requests authenticated with token, sent as "Authorization: Bearer <token>",
+// for admin actions (purging the cache, staging bin rules). An empty token rejects all requests.
+func AdminHandle(token string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, fmt.Errorf("method %v not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, errUnauthorized, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
 type HomeHandler struct{}
 
 func (h HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -27,20 +104,33 @@ func (h HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// MaterialsHandler lists the materials sorted by name, with the view query parameter:
+// - flat (default): a list of materials, with their parent_id
+// - tree: the taxonomy of materials, see MaterialTree
 type MaterialsHandler struct {
 	DB MaterialDB
 }
 
 func (m MaterialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+	if view != "" && view != "flat" && view != "tree" {
+		writeError(w, fmt.Errorf("invalid view %q, expected flat or tree", view), http.StatusBadRequest)
+		return
+	}
 
 	materials, err := m.DB.GetAll()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
-	out, err := json.Marshal(materials)
+	var out []byte
+	if view == "tree" {
+		out, err = json.Marshal(MaterialTree(materials))
+	} else {
+		out, err = json.Marshal(materials)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 	fmt.Fprintf(w, "%s", out)
@@ -59,13 +149,13 @@ func (h AddBlacklistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ean := r.FormValue("ean")
 
 	if url == "" || ean == "" {
-		http.Error(w, "missing form data", http.StatusInternalServerError)
+		writeError(w, errors.New("missing form data"), http.StatusBadRequest)
 		return
 	}
 
+	ean = canonicalEAN(ean)
 	if !h.Fetcher.IsURLValidForEAN(url, ean) {
-		msg := fmt.Sprintf("url %v invalid for ean %v", url, ean)
-		http.Error(w, msg, http.StatusInternalServerError)
+		writeError(w, fmt.Errorf("url %v invalid for ean %v", url, ean), http.StatusBadRequest)
 		return
 	}
 
@@ -92,25 +182,28 @@ func (h AddPackageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	materialsStr := r.FormValue("materials")
 	ean := r.FormValue("ean")
 	if materialsStr == "" || ean == "" {
-		http.Error(w, "missing form data", http.StatusInternalServerError)
+		writeError(w, errors.New("missing form data"), http.StatusBadRequest)
 		return
 	}
 
-	if !eancheck.Valid(ean) {
-		msg := fmt.Sprintf("invalid ean %v", ean)
-		http.Error(w, msg, http.StatusInternalServerError)
+	gtin, err := NormalizeBarcode(ean)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w %v", errInvalidEAN, ean), http.StatusBadRequest)
 		return
 	}
+	ean = gtin
 
 	var materials []Material
-	err := json.Unmarshal([]byte(materialsStr), &materials)
+	err = json.Unmarshal([]byte(materialsStr), &materials)
 	if err != nil {
-		msg := fmt.Sprintf("invalid materials format %v for %v", materials, ean)
-		http.Error(w, msg, http.StatusInternalServerError)
+		writeError(w, fmt.Errorf("invalid materials format %v for %v", materialsStr, ean), http.StatusBadRequest)
 		return
 	}
 
-	h.DB.Set(ean, materials)
+	if err := h.DB.Set(ean, materials); err != nil {
+		writeError(w, err, errorStatus(err))
+		return
+	}
 	h.Logger.Println(fmt.Sprintf("Adding %v for %v", materials, ean))
 	fmt.Fprintf(w, "added")
 	go func() {
@@ -121,29 +214,178 @@ func (h AddPackageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
+// ThrowAwayHandler looks up a Product and where to throw its package away.
+// If Materials is set, materials are suggested for unknown packages (see ProductPackage.SuggestMaterials).
+// Bins are the ones of the region of the request (see RegionFromRequest), Region if it has none,
+// as of the date query parameter (see ParseDate), now by default.
 type ThrowAwayHandler struct {
 	DB          PackagesDB
 	BlacklistDB BlacklistDB
 	Fetcher     Fetcher
+	Materials   MaterialDB
+	Region      Region
 }
 
 func (h ThrowAwayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ean := r.URL.Path[len("/throwaway/"):]
-	product, err := h.Fetcher.Fetch(ean, h.BlacklistDB)
+	code := r.URL.Path[len("/throwaway/"):]
+	ean, err := NormalizeBarcode(code)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w %v", err, code), http.StatusBadRequest)
+		return
+	}
+	region, err := RegionFromRequest(r, h.Region)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	date := time.Now()
+	if s := r.URL.Query().Get("date"); s != "" {
+		if date, err = ParseDate(s); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	product, err := h.Fetcher.Fetch(r.Context(), ean, h.BlacklistDB)
+	if err != nil {
+		// restricted codes and coupons are not in product databases, explain why instead
+		if info, decodeErr := DecodeBarcode(ean); decodeErr == nil && info.Notice() != "" && isNotFound(err) {
+			writeError(w, errors.New(info.Notice()), http.StatusNotFound)
+			return
+		}
+		writeError(w, err, errorStatus(err))
 		return
 	}
 	pkg, err := NewProductPackage(product, h.DB)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
+	if h.Materials != nil {
+		if err := pkg.SuggestMaterials(h.Materials); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
 
-	jsonBytes, err := pkg.ThrowAwayJSON(h.DB)
+	jsonBytes, err := pkg.ThrowAwayJSON(h.DB, region, date)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 	fmt.Fprintf(w, "%s", jsonBytes)
 }
+
+type PurgeCacheHandler struct {
+	Cache  ProductCacheDB
+	Logger *log.Logger
+}
+
+// ServeHTTP purges the cached lookup for the "ean" form value (any barcode format), or the whole cache if it is not set
+func (h PurgeCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	ean := r.FormValue("ean")
+	var err error
+	if ean == "" {
+		err = h.Cache.Purge()
+		h.Logger.Println("Purging product cache")
+	} else {
+		err = h.Cache.Delete(canonicalEAN(ean))
+		h.Logger.Println(fmt.Sprintf("Purging product cache for %s", ean))
+	}
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "purged")
+}
+
+type SourcesHealthHandler struct {
+	Fetcher interface {
+		Health() []SourceHealth
+	}
+}
+
+func (h SourcesHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	out, err := json.Marshal(h.Fetcher.Health())
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", out)
+}
+
+// UpcomingRulesHandler previews the changes of bins in the region of the request (see RegionFromRequest),
+// from now until the until query parameter (see ParseDate), DefaultUpcomingRulesWindow by default
+type UpcomingRulesHandler struct {
+	DB     RulesDB
+	Region Region
+}
+
+func (h UpcomingRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	region, err := RegionFromRequest(r, h.Region)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	until := now.Add(DefaultUpcomingRulesWindow)
+	if s := r.URL.Query().Get("until"); s != "" {
+		if until, err = ParseDate(s); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	changes, err := UpcomingBinChanges(h.DB, region, now, until)
+	if err != nil {
+		writeError(w, err, errorStatus(err))
+		return
+	}
+	out, err := json.Marshal(changes)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", out)
+}
+
+// StageRulesHandler adds the json list of BinRule of the "rules" form value.
+// Rules must start in the future: current rules are not changed, staged rules override them once they take effect.
+// It is an admin action, served behind AdminHandle.
+type StageRulesHandler struct {
+	DB     BinRulesDB
+	Logger *log.Logger
+	Mailer Mailer
+}
+
+func (h StageRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	rulesStr := r.FormValue("rules")
+	if rulesStr == "" {
+		writeError(w, errors.New("missing form data"), http.StatusBadRequest)
+		return
+	}
+	var rules []BinRule
+	if err := json.Unmarshal([]byte(rulesStr), &rules); err != nil || len(rules) == 0 {
+		writeError(w, fmt.Errorf("invalid rules format %v", rulesStr), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, rule := range rules {
+		if !rule.ValidFrom.After(now) {
+			writeError(w, fmt.Errorf("%w: material %v in %q must be valid from a future date", errInvalidBinRule, rule.MaterialID, rule.Region), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.DB.AddBinRules(rules); err != nil {
+		writeError(w, err, errorStatus(err))
+		return
+	}
+	h.Logger.Println(fmt.Sprintf("Staging rules %v", rulesStr))
+	fmt.Fprintf(w, "staged")
+	go func() {
+		err := h.Mailer(fmt.Sprintf("Staging %v bin rules", len(rules)), fmt.Sprintf("Rules staged:\n%v", rulesStr))
+		if err != nil {
+			h.Logger.Println(err)
+		}
+	}()
+}
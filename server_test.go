@@ -1,6 +1,7 @@
 package recycleme
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,11 +13,12 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type testFetcher FetchableURL
 
-func (f testFetcher) Fetch(ean string, db BlacklistDB) (Product, error) {
+func (f testFetcher) Fetch(ctx context.Context, ean string, db BlacklistDB) (Product, error) {
 	return Product{Name: "TEST", URL: fullURL(f.URL, ean), WebsiteName: f.WebsiteName, EAN: ean}, nil
 }
 
@@ -59,7 +61,7 @@ func TestAddBlacklistHandler(t *testing.T) {
 	data := url.Values{}
 	name := "test product"
 	data.Set("name", name)
-	ean := "EAN_TEST"
+	ean := "5029053038896"
 	data.Set("ean", ean)
 	url := fullURL(nopFetcher.URL, ean)
 	data.Set("url", url)
@@ -109,8 +111,8 @@ func TestAddBlacklistHandler(t *testing.T) {
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusInternalServerError {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
 	}
 }
 
@@ -136,12 +138,77 @@ func TestThrowAwayHandler(t *testing.T) {
 	}
 
 	url := fullURL(nopFetcher.URL, ean)
-	expected := fmt.Sprintf(`{"product":{"ean":"%s","name":"TEST","url":"%s","image_url":"","website_url":"","website_name":"%s","materials":[]},"throwAway":{}}`, ean, url, nopFetcher.WebsiteName)
+	expected := fmt.Sprintf(`{"product":{"ean":"%s","name":"TEST","url":"%s","image_url":"","website_url":"","website_name":"%s","materials":[],"barcode":{"gtin":"%s","prefix":"400","country":"Germany","category":"product"}},"throwAway":{}}`, ean, url, nopFetcher.WebsiteName, ean)
 	if rr.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
 
+func TestThrowAwayHandlerSuggestions(t *testing.T) {
+	calls := int32(0)
+	fetcher := countingFetcher{calls: &calls, p: Product{Name: "TEST", Packaging: &PackagingData{Tags: []string{"fr:bouteille-en-verre", "en:metal-cap"}}}}
+	handler := ThrowAwayHandler{
+		DB:          packageDB,
+		BlacklistDB: blacklistDB,
+		Fetcher:     fetcher,
+		Materials:   packageDB,
+	}
+
+	var v struct {
+		Product ProductPackage `json:"product"`
+	}
+	for ean, expected := range map[string][]Material{
+		"4006381333634": {{ID: 4, Name: "Bouteille de verre"}, {ID: 7, Name: "Bouchon de bouteille en métal"}},
+		"7613034383808": nil,
+	} {
+		req, err := http.NewRequest("GET", "/throwaway/"+ean, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		v.Product = ProductPackage{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(v.Product.SuggestedMaterials) != fmt.Sprint(expected) {
+			t.Errorf("invalid suggested materials for %v: got %v want %v", ean, v.Product.SuggestedMaterials, expected)
+		}
+	}
+}
+
+func TestThrowAwayHandlerCancel(t *testing.T) {
+	ean := "4006381333634"
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", "/throwaway/"+ean, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := blockingFetcher{cancelled: make(chan struct{})}
+	handler := ThrowAwayHandler{
+		DB:          packageDB,
+		BlacklistDB: blacklistDB,
+		Fetcher:     DefaultFetcher{fetchers: []Fetcher{slow}},
+	}
+
+	// client disconnects
+	cancel()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	select {
+	case <-slow.cancelled:
+	case <-time.After(time.Second):
+		t.Error("lookup was not aborted")
+	}
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	}
+}
+
 func TestMaterialsHandler(t *testing.T) {
 	req, err := http.NewRequest("GET", "/materials/", nil)
 	if err != nil {
@@ -175,6 +242,42 @@ func TestMaterialsHandler(t *testing.T) {
 	}
 }
 
+func TestMaterialsHandlerTree(t *testing.T) {
+	handler := MaterialsHandler{
+		DB: packageDB,
+	}
+	req := httptest.NewRequest("GET", "/materials/?view=tree", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var tree []MaterialNode
+	if err := json.Unmarshal(rr.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	var plastic *MaterialNode
+	for i, node := range tree {
+		if node.ParentID != 0 {
+			t.Errorf("roots should be families, got %+v", node.Material)
+		}
+		if node.Name == "Plastique" {
+			plastic = &tree[i]
+		}
+	}
+	if plastic == nil || len(plastic.Children) != 2 || plastic.Children[0].Name != "PET" || len(plastic.Children[0].Children) != 1 ||
+		plastic.Children[0].Children[0].Name != "Barquette PET" || plastic.Children[1].Name != "Pot de yaourt" {
+		t.Errorf("unexpected plastic family %+v", plastic)
+	}
+
+	req = httptest.NewRequest("GET", "/materials/?view=graph", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
 func TestAddPackageHandler(t *testing.T) {
 	data := url.Values{}
 	ean := "5021991938818"
@@ -190,7 +293,7 @@ func TestAddPackageHandler(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	m := newMailTester("Adding package for "+ean, fmt.Sprintf("Materials added to %v:\n%v", ean, "[{1 Boîte carton} {2 Film plastique}]"))
+	m := newMailTester("Adding package for "+ean, fmt.Sprintf("Materials added to %v:\n%v", ean, "[{1 Boîte carton 0} {2 Film plastique 0}]"))
 	handler := AddPackageHandler{
 		Logger: log.New(ioutil.Discard, "", 0),
 		DB:     packageDB,
@@ -242,8 +345,119 @@ func TestAddPackageHandler(t *testing.T) {
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusInternalServerError {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	var body errorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Error != "invalid ean invalid" {
+		t.Errorf("handler returned unexpected error body %v: %v", rr.Body.String(), err)
+	}
+}
+
+func TestPurgeCacheHandler(t *testing.T) {
+	db := NewMemoryDB()
+	cacheDB := NewMemoryProductCacheDB(db)
+	for _, ean := range []string{"5029053038896", "4006381333634", "0036000291452"} {
+		if err := cacheDB.Set(CachedProduct{EAN: ean, Found: true, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := PurgeCacheHandler{Cache: cacheDB, Logger: log.New(ioutil.Discard, "", 0)}
+
+	data := url.Values{}
+	data.Set("ean", "5029053038896")
+	req, err := createPostRequest("/cache/purge", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if _, ok, _ := cacheDB.Get("5029053038896"); ok {
+		t.Error("5029053038896 not purged")
+	}
+	if _, ok, _ := cacheDB.Get("4006381333634"); !ok {
+		t.Error("4006381333634 should not be purged")
+	}
+
+	// lookups are cached by normalized barcode, a UPC-A purges its EAN-13
+	data.Set("ean", "036000291452")
+	req, err = createPostRequest("/cache/purge", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if _, ok, _ := cacheDB.Get("0036000291452"); ok {
+		t.Error("0036000291452 not purged")
+	}
+
+	req, err = createPostRequest("/cache/purge", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Body.String() != "purged" {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), "purged")
+	}
+	if _, ok, _ := cacheDB.Get("4006381333634"); ok {
+		t.Error("cache not purged")
+	}
+}
+
+func TestAdminHandle(t *testing.T) {
+	called := 0
+	handler := func(token string) http.HandlerFunc {
+		return AdminHandle(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called++
+		}))
+	}
+	for _, test := range []struct {
+		method, token, auth string
+		expected            int
+	}{
+		{"POST", "secret", "Bearer secret", http.StatusOK},
+		{"POST", "secret", "", http.StatusUnauthorized},
+		{"POST", "secret", "Bearer other", http.StatusUnauthorized},
+		{"POST", "secret", "secret", http.StatusUnauthorized},
+		{"POST", "", "Bearer ", http.StatusUnauthorized},
+		{"GET", "secret", "Bearer secret", http.StatusMethodNotAllowed},
+	} {
+		req, err := createPostRequest("/cache/purge", url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Method = test.method
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rr := httptest.NewRecorder()
+		handler(test.token)(rr, req)
+		if rr.Code != test.expected {
+			t.Errorf("%v with %q for token %q: expected status %v, got %v", test.method, test.auth, test.token, test.expected, rr.Code)
+		}
+	}
+	if called != 1 {
+		t.Errorf("only the authorized request should be served, got %v", called)
+	}
+}
+
+func TestSourcesHealthHandler(t *testing.T) {
+	req, err := http.NewRequest("GET", "/sources/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := DefaultFetcher{fetchers: []Fetcher{newBreakerFetcher(testFetcher{URL: "http://www.example.com/%s/", WebsiteName: "Example.com"})}}
+	rr := httptest.NewRecorder()
+	SourcesHealthHandler{Fetcher: fetcher}.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	expected := `[{"name":"recycleme.testFetcher","state":"closed","consecutive_failures":0,"successes":0,"failures":0}]`
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
 
@@ -269,3 +483,158 @@ func TestNoCacheHandle(t *testing.T) {
 		}
 	}
 }
+
+func TestThrowAwayHandlerErrors(t *testing.T) {
+	for _, test := range []struct {
+		path    string
+		err     error
+		status  int
+		body    string
+		sources int
+	}{
+		{"/throwaway/invalid", nil, http.StatusBadRequest, "invalid ean invalid", 0},
+		{"/throwaway/5029053038896", fetchErrors{newProductError("5029053038896", "http://www.example.com/5029053038896", errNotFound),
+			newProductError("5029053038896", "http://www.example.org/5029053038896", errBlacklisted)}, http.StatusNotFound, "no product found", 2},
+		{"/throwaway/5029053038896", fetchErrors{newProductError("5029053038896", "http://www.example.com/5029053038896", errCircuitOpen)},
+			http.StatusBadGateway, "no product found, all sources are unavailable", 1},
+	} {
+		calls := int32(0)
+		handler := ThrowAwayHandler{DB: packageDB, BlacklistDB: blacklistDB, Fetcher: countingFetcher{calls: &calls, err: test.err}}
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var body errorBody
+		if rr.Code != test.status {
+			t.Errorf("%v: handler returned wrong status code: got %v want %v", test.err, rr.Code, test.status)
+		} else if rr.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Errorf("%v: errors should be json, got %v", test.err, rr.Header().Get("Content-Type"))
+		} else if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Error(err)
+		} else if body.Error != test.body || len(body.Sources) != test.sources {
+			t.Errorf("%v: unexpected error body %v", test.err, rr.Body.String())
+		}
+	}
+}
+
+func TestThrowAwayHandlerRegion(t *testing.T) {
+	calls := int32(0)
+	handler := ThrowAwayHandler{
+		DB:          packageDB,
+		BlacklistDB: blacklistDB,
+		Fetcher:     countingFetcher{calls: &calls, p: Product{Name: "TEST"}},
+		Region:      Region{Country: "FR", Department: "69"},
+	}
+	for path, expected := range map[string]string{
+		"/throwaway/7613034383808":                 "Bac à couvercle marron",
+		"/throwaway/7613034383808?region=FR-69001": "Bac à couvercle vert",
+		"/throwaway/7613034383808?region=FR-75011": "Bac à couvercle vert",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var v throwAwaypackage
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if bin := v.ThrowAway["Nourriture"]; bin != expected {
+			t.Errorf("%v: food should go to %v, got %v", path, expected, bin)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/throwaway/7613034383808?region=Paris", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid regions should be rejected, got %v", rr.Code)
+	}
+}
+
+func TestStageRulesHandler(t *testing.T) {
+	start := time.Now().UTC().AddDate(0, 1, 0).Truncate(time.Second)
+	rules, err := json.Marshal([]BinRule{{Region: "FR-33", MaterialID: 2, BinID: 2, ValidFrom: start}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := url.Values{}
+	data.Set("rules", string(rules))
+	req, err := createPostRequest("/rules/stage", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMailTester("Staging 1 bin rules", "Rules staged:\n"+string(rules))
+	handler := StageRulesHandler{DB: packageDB, Logger: log.New(ioutil.Discard, "", 0), Mailer: m.sendMail}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	m.wg.Wait()
+	if rr.Code != http.StatusOK || rr.Body.String() != "staged" {
+		t.Errorf("handler returned unexpected response: %v %v", rr.Code, rr.Body.String())
+	}
+	if m.err != nil {
+		t.Error(m.err)
+	}
+
+	for _, rules := range []string{
+		`[{"region": "FR-33", "material_id": 2, "bin_id": 2}]`,
+		`[{"region": "FR-33", "material_id": 2, "bin_id": 2, "valid_from": "2020-01-01T00:00:00Z"}]`,
+		`[{"region": "Bordeaux", "material_id": 2, "bin_id": 2, "valid_from": "` + start.Format(time.RFC3339) + `"}]`,
+		`[]`,
+	} {
+		data.Set("rules", rules)
+		req, err := createPostRequest("/rules/stage", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: only rules starting in the future should be staged, got %v", rules, rr.Code)
+		}
+	}
+
+	req, err = http.NewRequest("GET", "/rules/upcoming?region=FR-33", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	UpcomingRulesHandler{DB: packageDB}.ServeHTTP(rr, req)
+	var changes []BinChange
+	if err := json.Unmarshal(rr.Body.Bytes(), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Date.Equal(start) || changes[0].Material.ID != 2 || changes[0].To == nil || changes[0].To.ID != 2 {
+		t.Errorf("the staged rule should be previewed, got %v", rr.Body.String())
+	}
+
+	for date, expected := range map[string]string{
+		"":                         "Bac à couvercle vert",
+		start.Format("2006-01-02"): "Bac à couvercle vert",
+		start.Format(time.RFC3339): "Bac à couvercle jaune",
+		start.AddDate(0, 0, 1).Format("2006-01-02"): "Bac à couvercle jaune",
+	} {
+		calls := int32(0)
+		handler := ThrowAwayHandler{DB: packageDB, BlacklistDB: blacklistDB, Fetcher: countingFetcher{calls: &calls, p: Product{Name: "TEST"}}}
+		req, err := http.NewRequest("GET", "/throwaway/7613034383808?region=FR-33&date="+url.QueryEscape(date), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var v throwAwaypackage
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if bin := v.ThrowAway["Film plastique"]; bin != expected {
+			t.Errorf("%v: plastic film should go to %v, got %v", date, expected, bin)
+		}
+	}
+}
@@ -0,0 +1,639 @@
+package recycleme
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// sqlite3 driver for database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlMigration is a forward-only schema change, applied in a transaction
+// Migrations must never be edited once released, add a new one instead.
+type sqlMigration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+var sqlMigrations = []sqlMigration{
+	{
+		version:     1,
+		description: "initial schema",
+		statements: []string{
+			`CREATE TABLE bins (
+				id INTEGER PRIMARY KEY,
+				name TEXT NOT NULL
+			)`,
+			`CREATE TABLE materials (
+				id INTEGER PRIMARY KEY,
+				name TEXT NOT NULL
+			)`,
+			`CREATE TABLE materials_to_bins (
+				material_id INTEGER PRIMARY KEY REFERENCES materials(id),
+				bin_id INTEGER NOT NULL REFERENCES bins(id)
+			)`,
+			`CREATE TABLE packages (
+				ean TEXT NOT NULL,
+				material_id INTEGER NOT NULL REFERENCES materials(id),
+				PRIMARY KEY (ean, material_id)
+			)`,
+			`CREATE TABLE blacklist (
+				url TEXT PRIMARY KEY
+			)`,
+			`CREATE TABLE local_products (
+				ean TEXT NOT NULL,
+				name TEXT NOT NULL DEFAULT '',
+				url TEXT NOT NULL DEFAULT '',
+				image_url TEXT NOT NULL DEFAULT '',
+				website_url TEXT NOT NULL DEFAULT '',
+				website_name TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX local_products_ean ON local_products(ean)`,
+		},
+	},
+	{
+		version:     2,
+		description: "product lookup cache",
+		statements: []string{
+			`CREATE TABLE product_cache (
+				ean TEXT PRIMARY KEY,
+				found BOOLEAN NOT NULL,
+				product TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     3,
+		description: "bin rules by region",
+		statements: []string{
+			`CREATE TABLE materials_to_bins_by_region (
+				region TEXT NOT NULL DEFAULT '',
+				material_id INTEGER NOT NULL REFERENCES materials(id),
+				bin_id INTEGER NOT NULL REFERENCES bins(id),
+				PRIMARY KEY (region, material_id)
+			)`,
+			`INSERT INTO materials_to_bins_by_region (region, material_id, bin_id) SELECT '', material_id, bin_id FROM materials_to_bins`,
+			`DROP TABLE materials_to_bins`,
+			`ALTER TABLE materials_to_bins_by_region RENAME TO materials_to_bins`,
+		},
+	},
+	{
+		version:     4,
+		description: "bin rules validity periods",
+		statements: []string{
+			`CREATE TABLE bin_rules (
+				id INTEGER PRIMARY KEY,
+				region TEXT NOT NULL DEFAULT '',
+				material_id INTEGER NOT NULL REFERENCES materials(id),
+				bin_id INTEGER NOT NULL REFERENCES bins(id),
+				valid_from TIMESTAMP,
+				valid_until TIMESTAMP
+			)`,
+			`INSERT INTO bin_rules (region, material_id, bin_id) SELECT region, material_id, bin_id FROM materials_to_bins`,
+			`DROP TABLE materials_to_bins`,
+			`ALTER TABLE bin_rules RENAME TO materials_to_bins`,
+			`CREATE INDEX materials_to_bins_material_region ON materials_to_bins(material_id, region)`,
+		},
+	},
+	{
+		version:     5,
+		description: "bins colour, icon, instructions and collection type",
+		statements: []string{
+			`ALTER TABLE bins ADD COLUMN color TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE bins ADD COLUMN icon_url TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE bins ADD COLUMN instructions TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE bins ADD COLUMN collection_type TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version:     6,
+		description: "material preparations",
+		statements: []string{
+			`CREATE TABLE material_preparations (
+				material_id INTEGER NOT NULL REFERENCES materials(id),
+				region TEXT NOT NULL DEFAULT '',
+				steps TEXT NOT NULL DEFAULT '[]',
+				warnings TEXT NOT NULL DEFAULT '[]',
+				PRIMARY KEY (material_id, region)
+			)`,
+		},
+	},
+	{
+		version:     7,
+		description: "materials taxonomy",
+		statements: []string{
+			`ALTER TABLE materials ADD COLUMN parent_id INTEGER REFERENCES materials(id)`,
+			`CREATE INDEX materials_parent ON materials(parent_id)`,
+		},
+	},
+}
+
+// OpenSQLDB opens a database from a connection URI, currently only sqlite is supported:
+// - sqlite://path/to/recycleme.db
+// - sqlite::memory:
+func OpenSQLDB(uri string) (*sql.DB, error) {
+	var dsn string
+	switch {
+	case strings.HasPrefix(uri, "sqlite://"):
+		dsn = strings.TrimPrefix(uri, "sqlite://")
+	case strings.HasPrefix(uri, "sqlite:"):
+		dsn = strings.TrimPrefix(uri, "sqlite:")
+	default:
+		return nil, fmt.Errorf("unsupported sql connection uri %v", uri)
+	}
+	if dsn == "" {
+		return nil, errors.New("invalid sqlite connection parameters")
+	}
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite does not handle concurrent writes, and :memory: databases are per connection
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func sqlSchemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return 0, err
+	}
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func latestSQLSchemaVersion() int {
+	return sqlMigrations[len(sqlMigrations)-1].version
+}
+
+// CheckSQLSchema returns an error if the database schema is not the one expected by this version
+func CheckSQLSchema(db *sql.DB) error {
+	version, err := sqlSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := latestSQLSchemaVersion(); version != latest {
+		return fmt.Errorf("database schema is at version %v, expected %v: run recycleme migrate", version, latest)
+	}
+	return nil
+}
+
+// MigrateSQLDB applies all missing migrations, in order, and returns the number of applied migrations
+func MigrateSQLDB(db *sql.DB) (int, error) {
+	version, err := sqlSchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if latest := latestSQLSchemaVersion(); version > latest {
+		return 0, fmt.Errorf("database schema version %v is newer than the latest known version %v", version, latest)
+	}
+
+	applied := 0
+	for _, m := range sqlMigrations {
+		if m.version <= version {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return applied, err
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return applied, fmt.Errorf("migration %v (%v) failed: %v", m.version, m.description, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)", m.version, m.description, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+type sqlDB struct {
+	db *sql.DB
+}
+
+type sqlPackagesDB struct {
+	sqlDB
+}
+
+func NewSQLPackageDB(db *sql.DB) *sqlPackagesDB {
+	return &sqlPackagesDB{sqlDB: sqlDB{db: db}}
+}
+
+func (db sqlPackagesDB) GetAll() ([]Material, error) {
+	rows, err := db.db.Query("SELECT id, name, COALESCE(parent_id, 0) FROM materials ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var m []Material
+	for rows.Next() {
+		var material Material
+		if err := rows.Scan(&material.ID, &material.Name, &material.ParentID); err != nil {
+			return nil, err
+		}
+		m = append(m, material)
+	}
+	return m, rows.Err()
+}
+
+// Get returns the package of ean, stored by canonical GTIN.
+// Packages stored before barcodes were normalized are found under their former key (see legacyEANs).
+func (db sqlPackagesDB) Get(ean string) (Package, error) {
+	p := Package{EAN: canonicalEAN(ean)}
+	for _, key := range append([]string{p.EAN}, legacyEANs(ean)...) {
+		materials, err := db.packageMaterials(key)
+		if err != nil {
+			return p, err
+		}
+		if len(materials) > 0 {
+			p.Materials = materials
+			return p, nil
+		}
+	}
+	return p, errPackageNotFound
+}
+
+// packageMaterials returns the materials of the package stored under key
+func (db sqlPackagesDB) packageMaterials(key string) ([]Material, error) {
+	rows, err := db.db.Query(`SELECT m.id, m.name, COALESCE(m.parent_id, 0) FROM packages p
+		JOIN materials m ON m.id = p.material_id
+		WHERE p.ean = ? ORDER BY m.id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var materials []Material
+	for rows.Next() {
+		var material Material
+		if err := rows.Scan(&material.ID, &material.Name, &material.ParentID); err != nil {
+			return nil, err
+		}
+		materials = append(materials, material)
+	}
+	return materials, rows.Err()
+}
+
+func (db sqlPackagesDB) Set(ean string, m []Material) error {
+	ean, err := NormalizeBarcode(ean)
+	if err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		return errors.New("no materials to add")
+	}
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM packages WHERE ean = ?", ean); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, material := range m {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO packages (ean, material_id) VALUES (?, ?)", ean, material.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBins returns the bin of each material in region at a date, from the valid rules of its most specific region
+// for the material or its ancestors
+func (db sqlPackagesDB) GetBins(m []Material, region Region, at time.Time) (map[Material]Bin, error) {
+	r := make(map[Material]Bin)
+	if len(m) == 0 {
+		return r, nil
+	}
+	parents, err := db.materialParents()
+	if err != nil {
+		return r, err
+	}
+	mIDMap := make(map[uint]Material)
+	var args []interface{}
+	seen := make(map[uint]bool)
+	for _, material := range m {
+		mIDMap[material.ID] = material
+		for _, id := range materialLineage(material.ID, parents) {
+			if !seen[id] {
+				seen[id] = true
+				args = append(args, id)
+			}
+		}
+	}
+	nMaterials := len(args)
+	codes := region.Codes()
+	for _, code := range codes {
+		args = append(args, code)
+	}
+	rows, err := db.db.Query(`SELECT mb.region, mb.material_id, mb.valid_from, mb.valid_until, b.id, b.name, b.color, b.icon_url, b.instructions, b.collection_type FROM materials_to_bins mb
+		JOIN bins b ON b.id = mb.bin_id
+		WHERE mb.material_id IN (`+sqlPlaceholders(nMaterials)+`) AND mb.region IN (`+sqlPlaceholders(len(codes))+`)`, args...)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	var rules []BinRule
+	bins := make(map[uint]Bin)
+	for rows.Next() {
+		var rule BinRule
+		var validFrom, validUntil sql.NullTime
+		var bin Bin
+		if err := rows.Scan(&rule.Region, &rule.MaterialID, &validFrom, &validUntil, &bin.ID, &bin.Name, &bin.Color, &bin.IconURL, &bin.Instructions, &bin.CollectionType); err != nil {
+			return r, err
+		}
+		rule.BinID = bin.ID
+		rule.ValidFrom, rule.ValidUntil = validFrom.Time, validUntil.Time
+		rules = append(rules, rule)
+		bins[bin.ID] = bin
+	}
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+	for materialID, binID := range mostSpecificBins(rules, codes, at, parents) {
+		if material, ok := mIDMap[materialID]; ok {
+			r[material] = bins[binID]
+		}
+	}
+	return r, nil
+}
+
+// materialParents returns the parent ID of each material of the taxonomy having one
+func (db sqlPackagesDB) materialParents() (map[uint]uint, error) {
+	rows, err := db.db.Query("SELECT id, parent_id FROM materials WHERE parent_id IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	parents := make(map[uint]uint)
+	for rows.Next() {
+		var id, parentID uint
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = parentID
+	}
+	return parents, rows.Err()
+}
+
+// GetPreparations returns the preparation of each material from its most specific region, for the material or its ancestors.
+// Steps and warnings are json lists.
+func (db sqlPackagesDB) GetPreparations(m []Material, r Region) (map[uint]Preparation, error) {
+	out := make(map[uint]Preparation)
+	if len(m) == 0 {
+		return out, nil
+	}
+	parents, err := db.materialParents()
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	seen := make(map[uint]bool)
+	for _, material := range m {
+		for _, id := range materialLineage(material.ID, parents) {
+			if !seen[id] {
+				seen[id] = true
+				args = append(args, id)
+			}
+		}
+	}
+	nMaterials := len(args)
+	codes := r.Codes()
+	for _, code := range codes {
+		args = append(args, code)
+	}
+	rows, err := db.db.Query(`SELECT material_id, region, steps, warnings FROM material_preparations
+		WHERE material_id IN (`+sqlPlaceholders(nMaterials)+`) AND region IN (`+sqlPlaceholders(len(codes))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var preparations []Preparation
+	for rows.Next() {
+		var p Preparation
+		var steps, warnings []byte
+		if err := rows.Scan(&p.MaterialID, &p.Region, &steps, &warnings); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(steps, &p.Steps); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(warnings, &p.Warnings); err != nil {
+			return nil, err
+		}
+		preparations = append(preparations, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	best := mostSpecificPreparations(preparations, codes, parents)
+	for _, material := range m {
+		if p, ok := best[material.ID]; ok {
+			out[material.ID] = p
+		}
+	}
+	return out, nil
+}
+
+func (db sqlPackagesDB) BinRules(r Region) ([]BinRule, error) {
+	codes := r.Codes()
+	args := make([]interface{}, 0, len(codes))
+	for _, code := range codes {
+		args = append(args, code)
+	}
+	rows, err := db.db.Query(`SELECT region, material_id, bin_id, valid_from, valid_until FROM materials_to_bins
+		WHERE region IN (`+sqlPlaceholders(len(codes))+`) ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []BinRule
+	for rows.Next() {
+		var rule BinRule
+		var validFrom, validUntil sql.NullTime
+		if err := rows.Scan(&rule.Region, &rule.MaterialID, &rule.BinID, &validFrom, &validUntil); err != nil {
+			return nil, err
+		}
+		rule.ValidFrom, rule.ValidUntil = validFrom.Time, validUntil.Time
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (db sqlPackagesDB) AddBinRules(rules []BinRule) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		rule, err := normalizeBinRule(rule)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO materials_to_bins (region, material_id, bin_id, valid_from, valid_until) VALUES (?, ?, ?, ?, ?)",
+			rule.Region, rule.MaterialID, rule.BinID, sqlNullTime(rule.ValidFrom), sqlNullTime(rule.ValidUntil)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlNullTime stores zero times as NULL
+func sqlNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+type sqlBlacklistDB struct {
+	sqlDB
+}
+
+func NewSQLBlacklistDB(db *sql.DB) *sqlBlacklistDB {
+	return &sqlBlacklistDB{sqlDB: sqlDB{db: db}}
+}
+
+func (db sqlBlacklistDB) Contains(url string) (bool, error) {
+	var n int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM blacklist WHERE url = ?", url).Scan(&n); err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (db sqlBlacklistDB) Add(url string) error {
+	_, err := db.db.Exec("INSERT OR IGNORE INTO blacklist (url) VALUES (?)", url)
+	return err
+}
+
+type sqlLocalProductDB struct {
+	sqlDB
+}
+
+func NewSQLLocalProductDB(db *sql.DB) *sqlLocalProductDB {
+	return &sqlLocalProductDB{sqlDB: sqlDB{db: db}}
+}
+
+func (db sqlLocalProductDB) Fetch(ctx context.Context, ean string, blacklist BlacklistDB) (Product, error) {
+	rows, err := db.db.QueryContext(ctx, "SELECT ean, name, url, image_url, website_url, website_name FROM local_products WHERE ean = ?", ean)
+	if err != nil {
+		return Product{}, newProductError(ean, "/local/", err)
+	}
+	var products []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.EAN, &p.Name, &p.URL, &p.ImageURL, &p.WebsiteURL, &p.WebsiteName); err != nil {
+			rows.Close()
+			return Product{}, newProductError(ean, "/local/", err)
+		}
+		products = append(products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Product{}, newProductError(ean, "/local/", err)
+	}
+	if len(products) == 0 {
+		return Product{}, newProductError(ean, "/local/", errNotFound)
+	}
+	for _, p := range products {
+		url := "/local/" + p.WebsiteName + "/" + p.EAN
+		var product Product
+		product, err = withCheckInBlacklist(blacklist, ean, url, func() (Product, error) {
+			return p, nil
+		})
+		if err != nil {
+			continue
+		}
+		return product, nil
+	}
+	return Product{}, err
+}
+
+func (db sqlLocalProductDB) Name() string {
+	return LocalFetcherName
+}
+
+func (db sqlLocalProductDB) IsURLValidForEAN(myURL, ean string) bool {
+	if !strings.HasPrefix(myURL, "/local/") {
+		return false
+	}
+	// Looking for WebsiteName in /local/WebsiteName/EAN
+	websiteName := strings.TrimSuffix(strings.TrimPrefix(myURL, "/local/"), "/"+ean)
+	var n int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM local_products WHERE ean = ? AND website_name = ?", ean, websiteName).Scan(&n); err != nil {
+		return false
+	}
+	return n == 1
+}
+
+type sqlProductCacheDB struct {
+	sqlDB
+}
+
+func NewSQLProductCacheDB(db *sql.DB) *sqlProductCacheDB {
+	return &sqlProductCacheDB{sqlDB: sqlDB{db: db}}
+}
+
+func (db sqlProductCacheDB) Get(ean string) (CachedProduct, bool, error) {
+	c := CachedProduct{EAN: ean}
+	var product []byte
+	err := db.db.QueryRow("SELECT found, product, expires_at FROM product_cache WHERE ean = ?", ean).Scan(&c.Found, &product, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return c, false, nil
+	} else if err != nil {
+		return c, false, err
+	}
+	if err := json.Unmarshal(product, &c.Product); err != nil {
+		return c, false, err
+	}
+	return c, true, nil
+}
+
+func (db sqlProductCacheDB) Set(c CachedProduct) error {
+	product, err := json.Marshal(c.Product)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec("INSERT OR REPLACE INTO product_cache (ean, found, product, expires_at) VALUES (?, ?, ?, ?)", c.EAN, c.Found, product, c.ExpiresAt.UTC())
+	return err
+}
+
+func (db sqlProductCacheDB) Delete(ean string) error {
+	_, err := db.db.Exec("DELETE FROM product_cache WHERE ean = ?", ean)
+	return err
+}
+
+func (db sqlProductCacheDB) Purge() error {
+	_, err := db.db.Exec("DELETE FROM product_cache")
+	return err
+}
@@ -0,0 +1,294 @@
+package recycleme
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func createSQLTestDB(t *testing.T) *sql.DB {
+	db, err := OpenSQLDB("sqlite::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateSQLDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var bins []Bin
+	if err := json.Unmarshal([]byte(binsJSON), &bins); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range bins {
+		if _, err := db.Exec("INSERT INTO bins (id, name, color, icon_url, instructions, collection_type) VALUES (?, ?, ?, ?, ?, ?)", b.ID, b.Name, b.Color, b.IconURL, b.Instructions, b.CollectionType); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var materialsWithBinID []struct {
+		Material `json:",inline"`
+		BinID    uint `json:"bin_id"`
+	}
+	if err := json.Unmarshal([]byte(materialsJSON), &materialsWithBinID); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range materialsWithBinID {
+		if _, err := db.Exec("INSERT INTO materials (id, name, parent_id) VALUES (?, ?, NULLIF(?, 0))", m.ID, m.Name, m.ParentID); err != nil {
+			t.Fatal(err)
+		}
+		if m.BinID == 0 {
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO materials_to_bins (material_id, bin_id) VALUES (?, ?)", m.ID, m.BinID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rules []BinRule
+	if err := json.Unmarshal([]byte(regionalBinsJSON), &rules); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if _, err := db.Exec("INSERT INTO materials_to_bins (region, material_id, bin_id) VALUES (?, ?, ?)", rule.Region, rule.MaterialID, rule.BinID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var preparations []Preparation
+	if err := json.Unmarshal([]byte(preparationsJSON), &preparations); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range preparations {
+		steps, _ := json.Marshal(p.Steps)
+		warnings, _ := json.Marshal(p.Warnings)
+		if _, err := db.Exec("INSERT INTO material_preparations (material_id, region, steps, warnings) VALUES (?, ?, ?, ?)", p.MaterialID, p.Region, steps, warnings); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var packages []mgoPackageItem
+	if err := json.Unmarshal([]byte(packagesJSON), &packages); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packages {
+		for _, id := range p.MaterialIDs {
+			if _, err := db.Exec("INSERT INTO packages (ean, material_id) VALUES (?, ?)", p.EAN, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return db
+}
+
+func TestSQLMigrations(t *testing.T) {
+	if _, err := OpenSQLDB("mysql://localhost"); err == nil {
+		t.Error("only sqlite should be supported")
+	}
+	db, err := OpenSQLDB("sqlite::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := CheckSQLSchema(db); err == nil {
+		t.Error("empty database should not have an up to date schema")
+	}
+	applied, err := MigrateSQLDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(sqlMigrations) {
+		t.Errorf("expected %v migrations to be applied, got %v", len(sqlMigrations), applied)
+	}
+	if err := CheckSQLSchema(db); err != nil {
+		t.Error(err)
+	}
+
+	applied, err = MigrateSQLDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 0 {
+		t.Errorf("migrations must only be applied once, got %v", applied)
+	}
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, 'from the future', CURRENT_TIMESTAMP)", latestSQLSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateSQLDB(db); err == nil {
+		t.Error("migrations must not run on a newer schema")
+	}
+}
+
+func TestSQLMigrateBinRules(t *testing.T) {
+	db, err := OpenSQLDB("sqlite::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := sqlSchemaVersion(db); err != nil {
+		t.Fatal(err)
+	}
+	// schema of version 2, with one bin per material
+	for _, m := range sqlMigrations[:2] {
+		for _, stmt := range m.statements {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)", m.version, m.description); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, stmt := range []string{
+		"INSERT INTO bins (id, name) VALUES (1, 'Bac à couvercle vert')",
+		"INSERT INTO materials (id, name) VALUES (2, 'Film plastique')",
+		"INSERT INTO materials_to_bins (material_id, bin_id) VALUES (2, 1)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := MigrateSQLDB(db); err != nil {
+		t.Fatal(err)
+	}
+	m := Material{ID: 2, Name: "Film plastique"}
+	bins, err := NewSQLPackageDB(db).GetBins([]Material{m}, Region{Country: "FR", Department: "75"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bins[m].Name != "Bac à couvercle vert" {
+		t.Errorf("existing rules should become the default ones, got %v", bins)
+	}
+}
+
+func TestSQLBinRulesDB(t *testing.T) {
+	db := createSQLTestDB(t)
+	defer db.Close()
+	testBinRulesDB(t, NewSQLPackageDB(db), "FR-13")
+}
+
+func TestSQLMaterialTaxonomy(t *testing.T) {
+	db := createSQLTestDB(t)
+	defer db.Close()
+	testMaterialTaxonomy(t, NewSQLPackageDB(db))
+}
+
+func TestSQLPackagesDB(t *testing.T) {
+	db := createSQLTestDB(t)
+	defer db.Close()
+	packageDB := NewSQLPackageDB(db)
+
+	pkg, err := packageDB.Get("7613034383808")
+	if err != nil {
+		t.Fatal(err)
+	}
+	materials := []Material{{ID: 1, Name: "Boîte carton"}, {ID: 2, Name: "Film plastique"}, {ID: 5, Name: "Nourriture"}}
+	if len(pkg.Materials) != len(materials) {
+		t.Fatalf("expected %v materials, got %v", materials, pkg.Materials)
+	}
+	for i, m := range materials {
+		if pkg.Materials[i] != m {
+			t.Errorf("got material %v, expected %v", pkg.Materials[i], m)
+		}
+	}
+
+	if _, err := packageDB.Get("9771674821123"); err != errPackageNotFound {
+		t.Errorf("expected %v, got %v", errPackageNotFound, err)
+	}
+
+	// packages stored before barcodes were normalized are still found
+	for _, legacy := range []string{"0000040170725", "036000291452"} {
+		if _, err := db.Exec("INSERT INTO packages (ean, material_id) VALUES (?, 1)", legacy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ean := range []string{"40170725", "0036000291452", "036000291452"} {
+		if pkg, err := packageDB.Get(ean); err != nil || len(pkg.Materials) != 1 || pkg.EAN != canonicalEAN(ean) {
+			t.Errorf("%v: legacy package not found, got %v, %v", ean, pkg, err)
+		}
+	}
+
+	bins, err := packageDB.GetBins(materials, Region{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	binNames := []string{"Bac à couvercle jaune", "Bac à couvercle vert", "Bac à couvercle vert"}
+	for i, m := range materials {
+		if bins[m].Name != binNames[i] {
+			t.Errorf("material %v belong to %v, not %v", m.Name, binNames[i], bins[m].Name)
+		}
+	}
+	if yellow := bins[materials[0]]; yellow.Color != "#f7d117" || yellow.IconURL == "" || yellow.Instructions == "" || yellow.CollectionType != CollectionKerbside {
+		t.Errorf("bins should be returned with their colour, icon, instructions and collection type, got %+v", yellow)
+	}
+	testRegionalBins(t, packageDB)
+	testPreparations(t, packageDB)
+
+	if err := packageDB.Set("invalid", materials); err != errInvalidEAN {
+		t.Errorf("expected %v, got %v", errInvalidEAN, err)
+	}
+	if err := packageDB.Set("9771674821123", []Material{materials[0], materials[0], materials[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if pkg, err := packageDB.Get("9771674821123"); err != nil {
+		t.Fatal(err)
+	} else if len(pkg.Materials) != 2 {
+		t.Errorf("expected 2 unique materials, got %v", pkg.Materials)
+	}
+
+	all, err := packageDB.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 13 {
+		t.Fatalf("expected 13 materials, got %v", all)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name > all[i].Name {
+			t.Errorf("materials not sorted by name: %v", all)
+		}
+	}
+}
+
+func TestSQLBlacklistAndLocalProductDB(t *testing.T) {
+	db := createSQLTestDB(t)
+	defer db.Close()
+	blacklist := NewSQLBlacklistDB(db)
+	localDB := NewSQLLocalProductDB(db)
+
+	if _, err := db.Exec("INSERT INTO local_products (ean, name, website_name) VALUES ('ean_test', 'name_test', 'website_name_test')"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := localDB.Fetch(context.Background(), "ean_test", blacklist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "name_test" || p.WebsiteName != "website_name_test" {
+		t.Errorf("Some attributes are invalid for: %v", p)
+	}
+	if !localDB.IsURLValidForEAN("/local/website_name_test/ean_test", "ean_test") {
+		t.Error("/local/website_name_test/ean_test should be true")
+	}
+
+	url := "/local/website_name_test/ean_test"
+	if err := blacklist.Add(url); err != nil {
+		t.Fatal(err)
+	}
+	if err := blacklist.Add(url); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := blacklist.Contains(url); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatalf("%v not in blacklist", url)
+	}
+	if _, err := localDB.Fetch(context.Background(), "ean_test", blacklist); err == nil {
+		t.Error("product should be blacklisted")
+	} else if err.(*productError).err != errBlacklisted {
+		t.Errorf("not a blacklist error: %v", err)
+	}
+}
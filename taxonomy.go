@@ -0,0 +1,82 @@
+package recycleme
+
+import "fmt"
+
+// MaterialNode is a Material of the taxonomy with its children, e.g. Plastique > PET > Bouteille PET.
+// Children are sorted as the materials they were built from (by name for MaterialDB.GetAll).
+type MaterialNode struct {
+	Material `json:",inline"`
+	Children []MaterialNode `json:"children,omitempty"`
+}
+
+// MaterialTree returns the taxonomy of materials, families (materials without a parent, or with an unknown one) being the roots
+func MaterialTree(materials []Material) []MaterialNode {
+	known := make(map[uint]bool, len(materials))
+	for _, m := range materials {
+		known[m.ID] = true
+	}
+	var roots []Material
+	children := make(map[uint][]Material)
+	for _, m := range materials {
+		if m.ParentID == 0 || !known[m.ParentID] {
+			roots = append(roots, m)
+		} else {
+			children[m.ParentID] = append(children[m.ParentID], m)
+		}
+	}
+	var nodes func(materials []Material) []MaterialNode
+	nodes = func(materials []Material) []MaterialNode {
+		var n []MaterialNode
+		for _, m := range materials {
+			n = append(n, MaterialNode{Material: m, Children: nodes(children[m.ID])})
+		}
+		return n
+	}
+	if len(roots) == 0 {
+		return []MaterialNode{}
+	}
+	return nodes(roots)
+}
+
+// materialParents returns the parent ID of each material having one
+func materialParents(materials []Material) map[uint]uint {
+	parents := make(map[uint]uint)
+	for _, m := range materials {
+		if m.ParentID != 0 {
+			parents[m.ID] = m.ParentID
+		}
+	}
+	return parents
+}
+
+// materialLineage returns id followed by the IDs of its ancestors in parents, from the closest one, stopping at a cycle
+func materialLineage(id uint, parents map[uint]uint) []uint {
+	lineage := []uint{id}
+	seen := map[uint]bool{id: true}
+	for parent, ok := parents[id]; ok && !seen[parent]; parent, ok = parents[parent] {
+		lineage = append(lineage, parent)
+		seen[parent] = true
+	}
+	return lineage
+}
+
+// validateMaterialParents checks the parents of materials exist and do not form a cycle
+func validateMaterialParents(materials map[uint]Material) error {
+	parents := make(map[uint]uint)
+	for _, m := range materials {
+		if m.ParentID == 0 {
+			continue
+		}
+		if _, ok := materials[m.ParentID]; !ok {
+			return fmt.Errorf("%w %v: unknown parent %v", errInvalidMaterial, m.ID, m.ParentID)
+		}
+		parents[m.ID] = m.ParentID
+	}
+	for id := range parents {
+		lineage := materialLineage(id, parents)
+		if last := lineage[len(lineage)-1]; parents[last] != 0 {
+			return fmt.Errorf("%w %v: its ancestors form a cycle", errInvalidMaterial, id)
+		}
+	}
+	return nil
+}
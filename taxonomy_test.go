@@ -0,0 +1,136 @@
+package recycleme
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMaterialTree(t *testing.T) {
+	materials := []Material{
+		{ID: 12, Name: "Barquette PET", ParentID: 11},
+		{ID: 4, Name: "Bouteille de verre"},
+		{ID: 11, Name: "PET", ParentID: 10},
+		{ID: 10, Name: "Plastique"},
+		{ID: 13, Name: "Pot de yaourt", ParentID: 10},
+		{ID: 14, Name: "Orphelin", ParentID: 42},
+	}
+	expected := []MaterialNode{
+		{Material: materials[1]},
+		{Material: materials[3], Children: []MaterialNode{
+			{Material: materials[2], Children: []MaterialNode{{Material: materials[0]}}},
+			{Material: materials[4]},
+		}},
+		{Material: materials[5]},
+	}
+	if tree := MaterialTree(materials); !reflect.DeepEqual(tree, expected) {
+		t.Errorf("expected %+v, got %+v", expected, tree)
+	}
+	if tree := MaterialTree(nil); len(tree) != 0 {
+		t.Errorf("no materials expected, got %v", tree)
+	}
+}
+
+func TestMaterialLineage(t *testing.T) {
+	parents := map[uint]uint{12: 11, 11: 10, 13: 10, 20: 21, 21: 20}
+	for id, expected := range map[uint][]uint{
+		12: {12, 11, 10},
+		13: {13, 10},
+		10: {10},
+		20: {20, 21},
+	} {
+		if lineage := materialLineage(id, parents); !reflect.DeepEqual(lineage, expected) {
+			t.Errorf("%v: expected %v, got %v", id, expected, lineage)
+		}
+	}
+
+	if err := validateMaterialParents(map[uint]Material{10: {ID: 10}, 11: {ID: 11, ParentID: 10}}); err != nil {
+		t.Error(err)
+	}
+	if err := validateMaterialParents(map[uint]Material{11: {ID: 11, ParentID: 10}}); !errors.Is(err, errInvalidMaterial) {
+		t.Errorf("parents must exist, got %v", err)
+	}
+	if err := validateMaterialParents(map[uint]Material{20: {ID: 20, ParentID: 21}, 21: {ID: 21, ParentID: 20}}); !errors.Is(err, errInvalidMaterial) {
+		t.Errorf("cycles must be rejected, got %v", err)
+	}
+}
+
+func TestMostSpecificBinsInheritance(t *testing.T) {
+	now := time.Now()
+	parents := map[uint]uint{11: 10, 12: 11, 13: 10}
+	rules := []BinRule{
+		{Region: "", MaterialID: 10, BinID: 1},
+		{Region: "", MaterialID: 11, BinID: 4},
+		{Region: "FR-69", MaterialID: 10, BinID: 2},
+		{Region: "FR-69001", MaterialID: 12, BinID: 3},
+	}
+	// the default rule of PET wins over the regional rule of plastics
+	for region, expected := range map[string]map[uint]uint{
+		"FR-75":    {10: 1, 11: 4, 12: 4, 13: 1},
+		"FR-69":    {10: 2, 11: 4, 12: 4, 13: 2},
+		"FR-69001": {10: 2, 11: 4, 12: 3, 13: 2},
+	} {
+		r, _ := ParseRegion(region)
+		if bins := mostSpecificBins(rules, r.Codes(), now, parents); !reflect.DeepEqual(bins, expected) {
+			t.Errorf("%v: expected %v, got %v", region, expected, bins)
+		}
+	}
+}
+
+func TestMostSpecificPreparationsInheritance(t *testing.T) {
+	parents := map[uint]uint{11: 10, 12: 11, 13: 10}
+	preparations := []Preparation{
+		{Region: "", MaterialID: 11, Steps: []string{"vider"}},
+		{Region: "FR-69", MaterialID: 10, Steps: []string{"rincer"}},
+		{Region: "FR-69001", MaterialID: 12, Steps: []string{"séparer"}},
+	}
+	for region, expected := range map[string]map[uint]uint{
+		"FR-75":    {11: 11, 12: 11},
+		"FR-69":    {10: 10, 11: 11, 12: 11, 13: 10},
+		"FR-69001": {10: 10, 11: 11, 12: 12, 13: 10},
+	} {
+		r, _ := ParseRegion(region)
+		best := mostSpecificPreparations(preparations, r.Codes(), parents)
+		from := make(map[uint]uint)
+		for id, p := range best {
+			from[id] = p.MaterialID
+		}
+		if !reflect.DeepEqual(from, expected) {
+			t.Errorf("%v: expected preparations of %v, got %v", region, expected, from)
+		}
+	}
+}
+
+// testMaterialTaxonomy checks materials of materialsJSON inherit the bin rules of their ancestors
+func testMaterialTaxonomy(t *testing.T, db RulesDB) {
+	all, err := db.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Material)
+	for _, m := range all {
+		byName[m.Name] = m
+	}
+	tray, pot := byName["Barquette PET"], byName["Pot de yaourt"]
+	if tray.ParentID != 11 || pot.ParentID != 10 {
+		t.Fatalf("materials should have their parent, got %+v and %+v", tray, pot)
+	}
+	for region, expected := range map[string][2]string{
+		"":      {"Bac à couvercle jaune", "Bac à couvercle vert"},
+		"FR-69": {"Bac à couvercle jaune", "Bac à couvercle jaune"},
+	} {
+		r, _ := ParseRegion(region)
+		bins, err := db.GetBins([]Material{tray, pot}, r, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bins) != 2 || bins[tray].Name != expected[0] || bins[pot].Name != expected[1] {
+			t.Errorf("%q: expected %v, got %v", region, expected, bins)
+		}
+	}
+}
+
+func TestPackagesDBMaterialTaxonomy(t *testing.T) {
+	testMaterialTaxonomy(t, packageDB)
+}